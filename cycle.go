@@ -30,6 +30,7 @@ import (
 type cycleEntry struct {
 	Key  key
 	Func *digreflect.Func
+	Path string // path of the child container, if any
 }
 
 type errCycleDetected struct {
@@ -50,7 +51,7 @@ func (e errCycleDetected) Error() string {
 		if i > 0 {
 			b.WriteString("\n\tdepends on ")
 		}
-		fmt.Fprintf(b, "%v provided by %v", entry.Key, entry.Func)
+		fmt.Fprintf(b, "%v provided by %v%v", entry.Key, entry.Func, inContainer(entry.Path))
 	}
 	return b.String()
 }
@@ -62,10 +63,18 @@ func IsCycleDetected(err error) bool {
 	return ok
 }
 
-func verifyAcyclic(c containerStore, n provider, k key) error {
+// dependent is a function whose dependencies are built from a container,
+// such as a constructor or an element decorator.
+type dependent interface {
+	Location() *digreflect.Func
+	ContainerPath() string
+	ParamList() paramList
+}
+
+func verifyAcyclic(c containerStore, n dependent, k key) error {
 	visited := make(map[key]struct{})
 	err := detectCycles(n, c, []cycleEntry{
-		{Key: k, Func: n.Location()},
+		{Key: k, Func: n.Location(), Path: n.ContainerPath()},
 	}, visited)
 	if err != nil {
 		err = errWrapf(err, "this function introduces a cycle")
@@ -73,7 +82,7 @@ func verifyAcyclic(c containerStore, n provider, k key) error {
 	return err
 }
 
-func detectCycles(n provider, c containerStore, path []cycleEntry, visited map[key]struct{}) error {
+func detectCycles(n dependent, c containerStore, path []cycleEntry, visited map[key]struct{}) error {
 	var err error
 	walkParam(n.ParamList(), paramVisitorFunc(func(param param) bool {
 		if err != nil {
@@ -93,6 +102,11 @@ func detectCycles(n provider, c containerStore, path []cycleEntry, visited map[k
 			}
 			providers = c.getValueProviders(p.Name, p.Type)
 		case paramGroupedSlice:
+			if p.Soft {
+				// Soft value groups don't call the constructors of the
+				// group, so they don't depend on them.
+				return false
+			}
 			// NOTE: The key uses the element type, not the slice type.
 			k = key{group: p.Group, t: p.Type.Elem()}
 			if _, ok := visited[k]; ok {
@@ -105,7 +119,7 @@ func detectCycles(n provider, c containerStore, path []cycleEntry, visited map[k
 			return true
 		}
 
-		entry := cycleEntry{Func: n.Location(), Key: k}
+		entry := cycleEntry{Func: n.Location(), Path: n.ContainerPath(), Key: k}
 
 		if len(path) > 0 {
 			// Only mark a key as visited if path exists, i.e. this is not the
@@ -129,12 +143,23 @@ func detectCycles(n provider, c containerStore, path []cycleEntry, visited map[k
 		}
 
 		for _, n := range providers {
-			if e := detectCycles(n, c, append(path, entry), visited); e != nil {
+			if e := detectCycles(n, n.Scope(c), append(path, entry), visited); e != nil {
 				err = e
 				return false
 			}
 		}
 
+		// The element decorators of a value group are called to build it,
+		// and their dependencies are built from their own containers.
+		if p, ok := param.(paramGroupedSlice); ok {
+			for _, d := range c.getElementDecorators(key{group: p.Group, t: p.Type.Elem()}) {
+				if e := detectCycles(d, d.container, append(path, entry), visited); e != nil {
+					err = e
+					return false
+				}
+			}
+		}
+
 		return true
 	}))
 
@@ -25,9 +25,12 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
+	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/dig/internal/digreflect"
@@ -60,9 +63,21 @@ type optionFunc func(*Container)
 func (f optionFunc) applyOption(c *Container) { f(c) }
 
 type provideOptions struct {
-	Name  string
-	Group string
-	As    []interface{}
+	Name       string
+	Group      string
+	As         []interface{}
+	Export     bool
+	Override   bool
+	Priority   int
+	CallerSkip int
+	Retry      *RetryPolicy
+	Timeout    time.Duration
+
+	// Location of the function given to Provide or Decorate, including the
+	// call site, and the ID of its node. These are set by Provide and
+	// Decorate, not by options.
+	Location *digreflect.Func
+	ID       NodeID
 }
 
 func (o *provideOptions) Validate() error {
@@ -71,10 +86,6 @@ func (o *provideOptions) Validate() error {
 			return fmt.Errorf(
 				"cannot use named values with value groups: name:%q provided with group:%q", o.Name, o.Group)
 		}
-		if len(o.As) > 0 {
-			return fmt.Errorf(
-				"cannot use dig.As with value groups: dig.As provided with group:%q", o.Group)
-		}
 	}
 
 	// Names must be representable inside a backquoted string. The only
@@ -88,6 +99,16 @@ func (o *provideOptions) Validate() error {
 		return fmt.Errorf("invalid dig.Group(%q): group names cannot contain backquotes", o.Group)
 	}
 
+	if o.Retry != nil {
+		if err := o.Retry.validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.Timeout < 0 {
+		return fmt.Errorf("invalid dig.Timeout(%v): timeouts cannot be negative", o.Timeout)
+	}
+
 	for _, i := range o.As {
 		t := reflect.TypeOf(i)
 
@@ -143,6 +164,17 @@ func Name(name string) ProvideOption {
 // constructor should be added to the specified group. See also the package
 // documentation about Value Groups.
 //
+// The group name may be followed by the "flatten" option, in which case the
+// constructor must produce a slice and each of its elements is added to the
+// group individually.
+//
+//   c.Provide(newHandlers, dig.Group("handlers,flatten"))
+//
+// Similarly, the "key=.." option adds the value to the group under the given
+// key.
+//
+//   c.Provide(newJSONCodec, dig.Group("codecs,key=json"))
+//
 // This option cannot be provided for constructors which produce result
 // objects.
 func Group(group string) ProvideOption {
@@ -170,6 +202,13 @@ func Group(group string) ProvideOption {
 //     return b, b, b
 //   })
 //
+// If used with dig.Group, the value produced by the constructor is added to
+// the group as its own type and as each of the interfaces. For example, the
+// following will add the buffer to the "readers" group as a *bytes.Buffer and
+// as an io.Reader.
+//
+//   c.Provide(newBuffer, dig.Group("readers"), dig.As(new(io.Reader)))
+//
 // If used with dig.Name, the type produced by the constructor and the types
 // specified with dig.As will all use the same name. For example,
 //
@@ -200,19 +239,110 @@ func As(i ...interface{}) ProvideOption {
 	})
 }
 
-// An InvokeOption modifies the default behavior of Invoke. It's included for
-// future functionality; currently, there are no concrete implementations.
+// Export is a ProvideOption which specifies that the values produced by a
+// constructor provided to a child container should be made available to the
+// parent of that container. See also Child.
+//
+// Values provided to a child container are private to the child and its own
+// descendants by default. Given,
+//
+//   child := c.Child("db")
+//   child.Provide(newConfig)
+//   child.Provide(newConnection, dig.Export(true))
+//
+// The connection may be requested from c, but the config may not. The
+// dependencies of an exported constructor are always resolved from the child
+// it was provided to, so newConnection may depend on the config.
+//
+// This option has no effect on constructors provided to a root container.
+func Export(export bool) ProvideOption {
+	return provideOptionFunc(func(opts *provideOptions) {
+		opts.Export = export
+	})
+}
+
+// Override is a ProvideOption which specifies that a constructor provided to
+// a child container replaces the providers of the same types in the ancestors
+// of that container. See also Child.
+//
+// The replacement is visible only from the child and its descendants. Given,
+//
+//   test := c.Child("test")
+//   test.Provide(newFakeClock, dig.Override(true))
+//
+// Functions invoked on the child, and constructors provided to the child,
+// receive the fake clock. Constructors provided to c, and functions invoked on
+// c, continue to receive the clock provided to c.
+//
+// This option has no effect on constructors provided to a root container.
+func Override(override bool) ProvideOption {
+	return provideOptionFunc(func(opts *provideOptions) {
+		opts.Override = override
+	})
+}
+
+// Priority is a ProvideOption for Decorate which orders the decorators of
+// the same values registered with the same container. Decorators with a
+// higher priority are applied first. Decorators have a priority of 0 by
+// default, and decorators with the same priority are applied in the order in
+// which they were registered. See also Decorate.
+//
+// Priority cannot be used with Provide.
+func Priority(p int) ProvideOption {
+	return provideOptionFunc(func(opts *provideOptions) {
+		opts.Priority = p
+	})
+}
+
+// CallerSkip is a ProvideOption which skips the given number of additional
+// stack frames when recording the call site of Provide or Decorate.
+//
+// The call site is included in errors and visualizations next to the
+// location of the function. Frameworks which call Provide on behalf of
+// their users may use this option to report the location of their users'
+// code instead of their own. Given,
+//
+//   func (m *Module) Provide(ctor interface{}) error {
+//     return m.c.Provide(ctor, dig.CallerSkip(1))
+//   }
+//
+// The call site of the constructors will be the callers of Module.Provide.
+func CallerSkip(skip int) ProvideOption {
+	return provideOptionFunc(func(opts *provideOptions) {
+		opts.CallerSkip = skip
+	})
+}
+
+// inspectCall returns the location of the function f given to Provide or
+// Decorate, along with the call site of Provide or Decorate. The argument
+// skip is the number of additional stack frames to ascend.
+func inspectCall(f interface{}, skip int) *digreflect.Func {
+	location := digreflect.InspectFunc(f)
+	location.CallSite = digreflect.Caller(skip + 1)
+	return location
+}
+
+// An InvokeOption modifies the default behavior of Invoke.
 type InvokeOption interface {
-	unimplemented()
+	applyInvokeOption(*invokeOptions)
+}
+
+type invokeOptions struct {
+	RollbackOnFailure bool
 }
 
+type invokeOptionFunc func(*invokeOptions)
+
+func (f invokeOptionFunc) applyInvokeOption(opts *invokeOptions) { f(opts) }
+
 // Container is a directed acyclic graph of types and their dependencies.
 type Container struct {
 	// Mapping from key to all the nodes that can provide a value for that
 	// key.
 	providers map[key][]*node
 
-	// All nodes in the container.
+	// All nodes provided to the container. This includes nodes which were
+	// exported and are registered with the parent container.
 	nodes []*node
 
 	// Values that have already been generated in the container.
@@ -221,6 +351,14 @@ type Container struct {
 	// Values groups that have already been generated in the container.
 	groups map[key][]reflect.Value
 
+	// Positions in groups of the values of value groups that were submitted
+	// with a key, indexed by that key.
+	keyedGroups map[key]map[string]int
+
+	// Values of value groups decorated by the element decorators of the
+	// container and its ancestors, indexed by the value they replace.
+	decoratedElements map[elementKey][]reflect.Value
+
 	// Source of randomness.
 	rand *rand.Rand
 
@@ -241,6 +379,67 @@ type Container struct {
 
 	// Decorator functions of already provided dependencies
 	decorators map[key][]*node
+
+	// Decorator functions applied to each value of a value group.
+	elementDecorators map[key][]*elementDecorator
+
+	// Functions to call when the container is detached from its parent.
+	cleanups []func()
+
+	// Flag indicating whether the container was detached from its parent.
+	detached bool
+
+	// Flag indicating whether the container was frozen to create request
+	// scopes. Frozen containers may no longer be modified.
+	frozen bool
+
+	// Observer notified of the activity of the container and its
+	// descendants, if any.
+	observer Observer
+
+	// Time of the first Invoke on the container or its descendants. This is
+	// only set on root containers.
+	invokedAt time.Time
+
+	// Source of the current time for the timings of the container.
+	clock func() time.Time
+
+	// Flag indicating whether panics of user-provided functions are
+	// recovered.
+	recoverPanics bool
+
+	// Identifier of the last function given to the container or its
+	// descendants. This is only set on root containers.
+	lastNodeID NodeID
+
+	// Changes made to the container and its descendants by the Invoke
+	// calls in progress which must be undone if they fail. This is only set
+	// on root containers.
+	invokeJournal *journal
+
+	// Values being built by the Invoke calls in progress and constructors
+	// which timed out. This is only set on root containers.
+	build buildState
+
+	// Guards the values of the container and its descendants, and the
+	// state of their constructors and decorators, once request scopes were
+	// created from any of them. Set to 1 by freeze. These are only set on
+	// root containers.
+	sharedMu sync.Mutex
+	shared   int32
+
+	// Flag indicating whether the container and its descendants were
+	// sealed. This is only set on root containers.
+	sealed bool
+
+	// Flag indicating whether the container was created by Child after its
+	// parent was sealed, in which case it isn't one of the children of its
+	// parent and cannot be used.
+	createdSealed bool
+
+	// Providers and decorators of the values resolved from this container,
+	// precomputed when it is sealed.
+	lookups *lookups
 }
 
 // containerWriter provides write access to the Container's underlying data
@@ -254,6 +453,10 @@ type containerWriter interface {
 	// submitGroupedValue submits a value to the value group with the provided
 	// name.
 	submitGroupedValue(name string, t reflect.Type, v reflect.Value)
+
+	// submitKeyedGroupedValue submits a value to the value group with the
+	// provided name under the given key.
+	submitKeyedGroupedValue(name, mapKey string, t reflect.Type, v reflect.Value)
 }
 
 // containerStore provides access to the Container's underlying data store.
@@ -266,10 +469,16 @@ type containerStore interface {
 	// Retrieves the value with the provided name and type, if any.
 	getValue(name string, t reflect.Type) (v reflect.Value, ok bool)
 
-	// Retrieves all values for the provided group and type.
+	// Retrieves all values for the provided group and type, decorated by
+	// the element decorators of the group.
 	//
 	// The order in which the values are returned is undefined.
-	getValueGroup(name string, t reflect.Type) ([]reflect.Value, bool)
+	getValueGroup(name string, t reflect.Type) ([]reflect.Value, error)
+
+	// Retrieves the values for the provided group and type that were
+	// submitted with a key, indexed by that key and decorated by the element
+	// decorators of the group.
+	getKeyedValueGroup(name string, t reflect.Type) (map[string]reflect.Value, error)
 
 	// Returns the providers that can produce a value with the given name and
 	// type.
@@ -282,6 +491,10 @@ type containerStore interface {
 	// Returns the decorator list of a particular node
 	getDecorators(k key) []*node
 
+	// Returns the decorators which are applied to each value of the given
+	// value group, in the order in which they must be applied.
+	getElementDecorators(k key) []*elementDecorator
+
 	createGraph() *dot.Graph
 }
 
@@ -293,6 +506,11 @@ type provider interface {
 	// Location returns where this constructor was defined.
 	Location() *digreflect.Func
 
+	// ContainerPath returns the path of the child container this constructor
+	// was provided to, or an empty string if it was provided to a root
+	// container.
+	ContainerPath() string
+
 	// ParamList returns information about the direct dependencies of this
 	// constructor.
 	ParamList() paramList
@@ -301,22 +519,32 @@ type provider interface {
 	// constructor.
 	ResultList() resultList
 
+	// Scope returns the container from which the dependencies of this
+	// constructor are resolved. The given containerStore is returned if the
+	// constructor was not provided to a container.
+	Scope(containerStore) containerStore
+
 	// Calls the underlying constructor, reading values from the
 	// containerStore as needed.
 	//
 	// The values produced by this provider should be submitted into the
-	// containerStore.
+	// container it is registered with.
 	Call(containerStore) error
 }
 
 // New constructs a Container.
 func New(opts ...Option) *Container {
 	c := &Container{
-		providers:  make(map[key][]*node),
-		values:     make(map[key]reflect.Value),
-		groups:     make(map[key][]reflect.Value),
-		decorators: make(map[key][]*node),
-		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		providers:         make(map[key][]*node),
+		values:            make(map[key]reflect.Value),
+		groups:            make(map[key][]reflect.Value),
+		keyedGroups:       make(map[key]map[string]int),
+		decoratedElements: make(map[elementKey][]reflect.Value),
+		decorators:        make(map[key][]*node),
+		elementDecorators: make(map[key][]*elementDecorator),
+		name:              "root",
+		rand:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		clock:             time.Now,
 	}
 
 	for _, opt := range opts {
@@ -338,6 +566,36 @@ func DeferAcyclicVerification() Option {
 	})
 }
 
+// RecoverFromPanics is an Option which recovers the panics of constructors,
+// decorators and invoked functions. Instead of crashing the program, a panic
+// is returned as an error from Invoke, whose RootCause is a PanicError
+// holding the value passed to panic and the stack of the panic.
+//
+//   err := c.Invoke(func(*Server) { ... })
+//   if p, ok := dig.RootCause(err).(dig.PanicError); ok {
+//     log.Printf("panic: %v\n%s", p.Value, p.Stack)
+//   }
+//
+// The option applies to the children of the container as well.
+func RecoverFromPanics() Option {
+	return optionFunc(func(c *Container) {
+		c.recoverPanics = true
+	})
+}
+
+// callFunc calls f with the given arguments. If recoverPanics is set, panics
+// of f are recovered and returned as a PanicError.
+func callFunc(f reflect.Value, args []reflect.Value, recoverPanics bool) (results []reflect.Value, err error) {
+	if recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				err = PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+	}
+	return f.Call(args), nil
+}
+
 // Changes the source of randomness for the container.
 //
 // This will help provide determinism during tests.
@@ -348,11 +606,13 @@ func setRand(r *rand.Rand) Option {
 }
 
 // knownTypes returns the types known to this container, including types known
-// by its descendants.
+// by its ancestors.
 func (c *Container) knownTypes() []reflect.Type {
 	typeSet := make(map[reflect.Type]struct{}, len(c.providers))
-	for k := range c.providers {
-		typeSet[k.t] = struct{}{}
+	for p := c; p != nil; p = p.parent {
+		for k := range p.providers {
+			typeSet[k.t] = struct{}{}
+		}
 	}
 
 	types := make([]reflect.Type, 0, len(typeSet))
@@ -360,58 +620,214 @@ func (c *Container) knownTypes() []reflect.Type {
 		types = append(types, t)
 	}
 
-	for _, c := range append(c.children) {
-		types = append(types, c.knownTypes()...)
-	}
-
 	sort.Sort(byTypeName(types))
 	return types
 }
 
 func (c *Container) getValue(name string, t reflect.Type) (v reflect.Value, ok bool) {
-	v, ok = c.values[key{name: name, t: t}]
+	k := key{name: name, t: t}
+	for p := c; p != nil; p = p.parent {
+		// Values are stored with the providers that produce them, so values
+		// of the ancestors are shadowed by the providers of this container.
+		if v, ok = p.values[k]; ok || len(p.providers[k]) > 0 {
+			return
+		}
+	}
 	return
 }
 
 func (c *Container) setValue(name string, t reflect.Type, v reflect.Value) {
 	k := key{t: t, name: name}
+	if j := c.journal(); j != nil {
+		old, ok := c.values[k]
+		j.record(func() {
+			if ok {
+				c.values[k] = old
+			} else {
+				delete(c.values, k)
+			}
+		})
+	}
 	c.values[k] = v
 }
 
-func (c *Container) getValueGroup(name string, t reflect.Type) ([]reflect.Value, bool) {
-	items, ok := c.groups[key{group: name, t: t}]
-	if !ok {
-		return []reflect.Value{}, ok
+func (c *Container) getValueGroup(name string, t reflect.Type) ([]reflect.Value, error) {
+	items, err := c.valueGroup(name, t)
+	if err != nil {
+		return nil, err
 	}
 	// shuffle the list so users don't rely on the ordering of grouped values
-	return shuffledCopy(c.rand, items), true
+	return shuffledCopy(c.rand.Perm, items), nil
+}
+
+// valueGroup returns the values of the given group submitted to this
+// container and its ancestors, decorated by the element decorators of this
+// container and its ancestors, in no particular order.
+func (c *Container) valueGroup(name string, t reflect.Type) ([]reflect.Value, error) {
+	k := key{group: name, t: t}
+	items := []reflect.Value{}
+	for p := c; p != nil; p = p.parent {
+		for i := range p.groups[k] {
+			vs, err := c.decoratedElement(k, p, i)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, vs...)
+		}
+	}
+	return items, nil
 }
 
 func (c *Container) submitGroupedValue(name string, t reflect.Type, v reflect.Value) {
 	k := key{group: name, t: t}
+	if j := c.journal(); j != nil {
+		n := len(c.groups[k])
+		j.record(func() { c.groups[k] = c.groups[k][:n] })
+	}
 	c.groups[k] = append(c.groups[k], v)
 }
 
+func (c *Container) getKeyedValueGroup(name string, t reflect.Type) (map[string]reflect.Value, error) {
+	k := key{group: name, t: t}
+	items := make(map[string]reflect.Value)
+	seen := make(map[string]struct{})
+	for p := c; p != nil; p = p.parent {
+		for mapKey, i := range p.keyedGroups[k] {
+			// Values submitted to a container shadow the values submitted
+			// to its ancestors with the same key.
+			if _, ok := seen[mapKey]; ok {
+				continue
+			}
+			seen[mapKey] = struct{}{}
+
+			vs, err := c.decoratedElement(k, p, i)
+			if err != nil {
+				return nil, err
+			}
+			switch len(vs) {
+			case 0:
+				// The value was removed from the group by its decorators.
+			case 1:
+				items[mapKey] = vs[0]
+			default:
+				return nil, fmt.Errorf("cannot decorate %v with key %q: "+
+					"decorators returned %d values for a single key", k, mapKey, len(vs))
+			}
+		}
+	}
+	return items, nil
+}
+
+func (c *Container) submitKeyedGroupedValue(name, mapKey string, t reflect.Type, v reflect.Value) {
+	k := key{group: name, t: t}
+	if c.keyedGroups[k] == nil {
+		c.keyedGroups[k] = make(map[string]int)
+	}
+	if j := c.journal(); j != nil {
+		old, ok := c.keyedGroups[k][mapKey]
+		j.record(func() {
+			if ok {
+				c.keyedGroups[k][mapKey] = old
+			} else {
+				delete(c.keyedGroups[k], mapKey)
+			}
+		})
+	}
+	c.keyedGroups[k][mapKey] = len(c.groups[k])
+	c.submitGroupedValue(name, t, v)
+}
+
+// elementKey identifies a value submitted to a value group: the value at the
+// given position in the values of the group submitted to a container.
+type elementKey struct {
+	key       key
+	container *Container
+	index     int
+}
+
+// decoratedElement returns the values which replace the value at position i
+// of the group k submitted to q, once decorated by the element decorators of
+// this container and its ancestors.
+//
+// Element decorators are called once for each value: the values they return
+// are cached with the container they were registered with, and shared by its
+// descendants.
+func (c *Container) decoratedElement(k key, q *Container, i int) ([]reflect.Value, error) {
+	if c == nil {
+		return []reflect.Value{q.groups[k][i]}, nil
+	}
+	ds := c.elementDecorators[k]
+	if len(ds) == 0 {
+		return c.parent.decoratedElement(k, q, i)
+	}
+
+	ek := elementKey{key: k, container: q, index: i}
+	if vs, ok := c.decoratedElements[ek]; ok {
+		return vs, nil
+	}
+	vs, err := c.parent.decoratedElement(k, q, i)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range ds {
+		var next []reflect.Value
+		for _, v := range vs {
+			out, err := d.Decorate(c, v)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		vs = next
+	}
+
+	if j := c.journal(); j != nil {
+		j.record(func() { delete(c.decoratedElements, ek) })
+	}
+	c.decoratedElements[ek] = vs
+	return vs, nil
+}
+
 func (c *Container) getValueProviders(name string, t reflect.Type) []provider {
+	if c.lookups != nil {
+		return c.lookups.valueProviders[key{name: name, t: t}]
+	}
+
+	// The providers of the nearest container shadow those of its ancestors.
 	providers := c.getProviders(key{name: name, t: t})
 
-	for _, c := range c.children {
-		providers = append(providers, c.getValueProviders(name, t)...)
+	if len(providers) == 0 && c.parent != nil {
+		return c.parent.getValueProviders(name, t)
 	}
 
 	return providers
 }
 
 func (c *Container) getGroupProviders(name string, t reflect.Type) []provider {
+	if c.lookups != nil {
+		return c.lookups.groupProviders[key{group: name, t: t}]
+	}
+
 	providers := c.getProviders(key{group: name, t: t})
 
-	for _, c := range c.children {
-		providers = append(providers, c.getGroupProviders(name, t)...)
+	if c.parent != nil {
+		providers = append(providers, c.parent.getGroupProviders(name, t)...)
 	}
 
 	return providers
 }
 
+// getDescendantNodes returns the nodes for the given key which were
+// registered with the descendants of this container.
+func (c *Container) getDescendantNodes(k key) []*node {
+	var nodes []*node
+	for _, cc := range c.children {
+		nodes = append(nodes, cc.providers[k]...)
+		nodes = append(nodes, cc.getDescendantNodes(k)...)
+	}
+	return nodes
+}
+
 func (c *Container) getProviders(k key) []provider {
 	nodes := c.providers[k]
 	providers := make([]provider, len(nodes))
@@ -421,33 +837,47 @@ func (c *Container) getProviders(k key) []provider {
 	return providers
 }
 
+// getDecorators returns the decorators of the given key which apply to values
+// resolved from this container, in the order in which they are applied: those
+// of the root first, and those of this container last. Decorators of other
+// containers, including the descendants of this container, don't apply.
 func (c *Container) getDecorators(k key) []*node {
-	p := c
-	if _, ok := c.providers[k]; !ok {
-		cont := c.children
-		for len(cont) > 0 {
-			v := cont[0]
-			cont = cont[1:]
-			if _, ok := v.providers[k]; !ok {
-				cont = append(cont, v.children...)
-			} else {
-				p = v
-				break
-			}
-		}
-	} else {
-		p = c
+	if c.lookups != nil {
+		return c.lookups.decorators[k]
 	}
-	decorators := make([]*node, 0)
-	for p != nil {
-		if _, ok := p.decorators[k]; ok {
-			decorators = append(decorators, p.decorators[k]...)
-		}
-		p = p.parent
+
+	var decorators []*node
+	for _, p := range c.lineage() {
+		decorators = append(decorators, p.decorators[k]...)
+	}
+	return decorators
+}
+
+func (c *Container) getElementDecorators(k key) []*elementDecorator {
+	if c.lookups != nil {
+		return c.lookups.elementDecorators[k]
+	}
+
+	var decorators []*elementDecorator
+	for _, p := range c.lineage() {
+		decorators = append(decorators, p.elementDecorators[k]...)
 	}
 	return decorators
 }
 
+// lineage returns the ancestors of this container, starting with the root,
+// followed by the container itself.
+func (c *Container) lineage() []*Container {
+	var cs []*Container
+	for p := c; p != nil; p = p.parent {
+		cs = append(cs, p)
+	}
+	for i, j := 0, len(cs)-1; i < j; i, j = i+1, j-1 {
+		cs[i], cs[j] = cs[j], cs[i]
+	}
+	return cs
+}
+
 func (c *Container) getRoot() *Container {
 	if c.parent == nil {
 		return c
@@ -473,6 +903,12 @@ func (c *Container) getRoot() *Container {
 // accepts constructors that specify dependencies as dig.In structs and/or
 // specify results as dig.Out structs.
 func (c *Container) Provide(constructor interface{}, opts ...ProvideOption) error {
+	if err := c.errIfReadOnly(); err != nil {
+		return err
+	}
+	if err := c.errIfSealed(); err != nil {
+		return err
+	}
 	ctype := reflect.TypeOf(constructor)
 	if ctype == nil {
 		return errors.New("can't provide an untyped nil")
@@ -488,14 +924,27 @@ func (c *Container) Provide(constructor interface{}, opts ...ProvideOption) erro
 	if err := options.Validate(); err != nil {
 		return err
 	}
+	options.Location = inspectCall(constructor, options.CallerSkip)
+	options.ID = c.newNodeID()
 
-	if err := c.provide(constructor, options); err != nil {
-		return errProvide{
-			Func:   digreflect.InspectFunc(constructor),
+	keys, err := c.provide(constructor, options)
+	if err != nil {
+		err = errProvide{
+			Func:   options.Location,
+			Path:   c.childPath(),
 			Reason: err,
 		}
 	}
-	return nil
+	if c.observer != nil {
+		c.observer.Observe(ProvideEvent{
+			ID:        options.ID,
+			Func:      options.Location,
+			Container: c.Path(),
+			Keys:      exportKeys(keys),
+			Err:       err,
+		})
+	}
+	return err
 }
 
 // Invoke runs the given function after instantiating its dependencies.
@@ -506,8 +955,14 @@ func (c *Container) Provide(constructor interface{}, opts ...ProvideOption) erro
 //
 // The function may return an error to indicate failure. The error will be
 // returned to the caller as-is.
-func (c *Container) Invoke(function interface{}, opts ...InvokeOption) error {
-	cp := c.getRoot() // run invoke on root to get access to all the graphs
+//
+// If c is a child container, the dependencies are resolved from c and its
+// ancestors only, and the decorators of c are applied to them. Errors which
+// prevent the function from being called name the path of the child.
+func (c *Container) Invoke(function interface{}, opts ...InvokeOption) (err error) {
+	if err := c.errIfUnusable(); err != nil {
+		return err
+	}
 	ftype := reflect.TypeOf(function)
 	if ftype == nil {
 		return errors.New("can't invoke an untyped nil")
@@ -516,33 +971,82 @@ func (c *Container) Invoke(function interface{}, opts ...InvokeOption) error {
 		return fmt.Errorf("can't invoke non-function %v (type %v)", function, ftype)
 	}
 
-	pl, err := newParamList(ftype)
+	var options invokeOptions
+	for _, o := range opts {
+		o.applyInvokeOption(&options)
+	}
+
+	if c.observer != nil {
+		defer observeInvoke(c.observer, function, c.Path())(&err)
+	}
+	if args, ok := c.invokedArgs(ftype); ok {
+		return c.callInvoked(function, args)
+	}
+	if options.RollbackOnFailure {
+		if atomic.LoadInt32(&c.getRoot().shared) != 0 {
+			return errors.New("cannot roll back an Invoke on containers used by request scopes")
+		}
+		defer c.beginTransaction()(&err)
+	}
+
+	args, err := c.prepareInvoke(function, ftype)
 	if err != nil {
+		if c.parent != nil {
+			return errWrapf(err, "cannot invoke function in child container %q", c.Path())
+		}
 		return err
 	}
 
-	if err := shallowCheckDependencies(cp, pl); err != nil {
-		return errMissingDependencies{
-			Func:   digreflect.InspectFunc(function),
-			Reason: err,
+	return c.callInvoked(function, args)
+}
+
+// prepareInvoke builds the arguments of a function of the given type passed
+// to Invoke. The values are built with the tree of containers locked if it is
+// shared with request scopes, but the function itself is called without the
+// lock so that it may use the containers.
+func (c *Container) prepareInvoke(function interface{}, ftype reflect.Type) ([]reflect.Value, error) {
+	defer c.lockShared()()
+	c.markInvoked()
+
+	pl, checked := c.checkedParams(ftype)
+	if !checked {
+		var err error
+		if pl, err = newParamList(ftype); err != nil {
+			return nil, err
 		}
 	}
+	args, err := c.buildInvokeArgs(function, pl, checked)
+	if err != nil {
+		return nil, err
+	}
+	c.rememberArgs(ftype, pl, args)
+	return args, nil
+}
 
-	if !cp.isVerifiedAcyclic {
-		if err := cp.verifyAcyclic(); err != nil {
-			return err
-		}
+// lockShared locks the tree of containers this container belongs to if
+// request scopes were created from any of them, and returns the function
+// which unlocks it.
+func (c *Container) lockShared() func() {
+	root := c.getRoot()
+	if atomic.LoadInt32(&root.shared) == 0 {
+		return func() {}
 	}
+	root.sharedMu.Lock()
+	return root.sharedMu.Unlock
+}
 
-	args, err := pl.BuildList(cp)
+// callInvoked calls a function passed to Invoke on this container or its
+// request scopes with the given arguments and returns the error it
+// returned, if any.
+func (c *Container) callInvoked(function interface{}, args []reflect.Value) error {
+	returned, err := callFunc(reflect.ValueOf(function), args, c.recoverPanics)
 	if err != nil {
-		return errArgumentsFailed{
+		return errPanicked{
 			Func:   digreflect.InspectFunc(function),
-			Reason: err,
+			Path:   c.childPath(),
+			Reason: err.(PanicError),
 		}
 	}
-
-	returned := reflect.ValueOf(function).Call(args)
 	if len(returned) == 0 {
 		return nil
 	}
@@ -554,7 +1058,96 @@ func (c *Container) Invoke(function interface{}, opts ...InvokeOption) error {
 	return nil
 }
 
+// buildInvokeArgs builds the arguments of a function invoked on this
+// container. The dependencies of the function aren't checked again if they
+// are known to be provided.
+func (c *Container) buildInvokeArgs(function interface{}, pl paramList, checked bool) ([]reflect.Value, error) {
+	if !checked {
+		if err := shallowCheckDependencies(c, pl); err != nil {
+			return nil, errMissingDependencies{
+				Func:   digreflect.InspectFunc(function),
+				Reason: err,
+			}
+		}
+
+		for p := c; p != nil; p = p.parent {
+			if !p.isVerifiedAcyclic {
+				if err := p.verifyAcyclic(); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if c.lookups != nil {
+			c.lookups.invoked[reflect.TypeOf(function)] = pl
+		}
+	}
+
+	args, err := pl.BuildList(c)
+	if err != nil {
+		return nil, errArgumentsFailed{
+			Func:   digreflect.InspectFunc(function),
+			Reason: err,
+		}
+	}
+	return args, nil
+}
+
+// Decorate registers a decorator for values already provided to the
+// container or its ancestors. The decorator receives the values it decorates as parameters and
+// returns their replacements.
+//
+// As with Provide, dig.Name names the values returned by the decorator. It
+// also names the parameters of the decorator which receive them.
+//
+//   c.Decorate(func(db *sql.DB) *sql.DB {
+//     return withTracing(db)
+//   }, dig.Name("primary"))
+//
+// With dig.As, the decorated value also replaces the values provided as the
+// given interfaces.
+//
+// Decorators of the same values form a chain in which each decorator receives
+// the value returned by the previous one. The decorators of the ancestors of
+// a container are applied before its own, and the decorators registered with
+// the same container are applied in the order in which they were registered
+// unless ordered with dig.Priority. See DecoratorChain.
+//
+// If used with dig.Group, the decorator is instead applied to each value of
+// the value group individually when the group is consumed from the container
+// or its descendants, including the values provided to its ancestors. Its
+// first parameter is the value being decorated, and its remaining parameters
+// are built from the container.
+//
+//   c.Decorate(func(h Handler, m *Metrics) Handler {
+//     return withMetrics(h, m)
+//   }, dig.Group("handlers"))
+//
+// With the "flatten" option, the decorator returns a slice of values which
+// replace the value being decorated. Returning an empty slice removes the
+// value from the group.
+//
+//   c.Decorate(func(h Handler) []Handler {
+//     if h.Disabled() {
+//       return nil
+//     }
+//     return []Handler{h}
+//   }, dig.Group("handlers,flatten"))
+//
+// Each value is decorated once by the element decorators of a container;
+// values consumed before they were registered are decorated again the next
+// time the group is consumed.
+//
+// Decorators apply only to values resolved from the container they were
+// registered with and its descendants. As such, different children may
+// decorate the same value of their parent differently.
 func (c *Container) Decorate(decorator interface{}, opts ...ProvideOption) error {
+	if err := c.errIfReadOnly(); err != nil {
+		return err
+	}
+	if err := c.errIfSealed(); err != nil {
+		return err
+	}
 	dtype := reflect.TypeOf(decorator)
 	if dtype == nil {
 		return errors.New("can't decorate with an untyped nil")
@@ -570,91 +1163,337 @@ func (c *Container) Decorate(decorator interface{}, opts ...ProvideOption) error
 	if err := options.Validate(); err != nil {
 		return err
 	}
+	options.Location = inspectCall(decorator, options.CallerSkip)
+	options.ID = c.newNodeID()
 
-	if err := c.decorate(decorator, options); err != nil {
-		return errConstructorFailed{
-			Func:   digreflect.InspectFunc(decorator),
+	keys, err := c.decorate(decorator, options)
+	if err != nil {
+		err = errConstructorFailed{
+			Func:   options.Location,
+			Path:   c.childPath(),
 			Reason: err,
 		}
 	}
-	return nil
+	if c.observer != nil {
+		c.observer.Observe(DecorateEvent{
+			ID:        options.ID,
+			Func:      options.Location,
+			Container: c.Path(),
+			Keys:      exportKeys(keys),
+			Err:       err,
+		})
+	}
+	return err
 }
 
 // Child returns a named child of this container. The child container has
-// full access to the parent's types, and any types provided to the child
-// will be made available to the parent.
+// full access to the parent's types. Types provided to the child are private
+// to the child and its descendants unless they are provided with the Export
+// option, in which case they are made available to the parent.
+//
+// Since private types are not visible outside of the child, sibling children
+// may provide the same types without conflicts. Types provided to the
+// ancestors of the child may be replaced within the child with the Override
+// option.
 //
 // The name of the child is for observability purposes only. As such, it
 // does not have to be unique across different children of the container.
+// Children which are no longer needed may be removed with Detach.
+//
+// Children of sealed containers are not added to the children of the
+// container, and cannot be used: Provide, Decorate and Invoke fail on them
+// with an error for which IsSealed returns true. See Seal.
 func (c *Container) Child(name string) *Container {
 	child := &Container{
-		providers:  make(map[key][]*node),
-		values:     make(map[key]reflect.Value),
-		groups:     make(map[key][]reflect.Value),
-		decorators: make(map[key][]*node),
-		rand:       c.rand,
-		name:       name,
-		parent:     c,
+		providers:         make(map[key][]*node),
+		values:            make(map[key]reflect.Value),
+		groups:            make(map[key][]reflect.Value),
+		keyedGroups:       make(map[key]map[string]int),
+		decoratedElements: make(map[elementKey][]reflect.Value),
+		decorators:        make(map[key][]*node),
+		elementDecorators: make(map[key][]*elementDecorator),
+		rand:              c.rand,
+		name:              name,
+		parent:            c,
+		detached:          c.detached,
+		observer:          c.observer,
+		recoverPanics:     c.recoverPanics,
+		clock:             c.clock,
+		createdSealed:     c.getRoot().sealed,
+	}
+
+	if !child.createdSealed {
+		c.children = append(c.children, child)
 	}
 
-	c.children = append(c.children, child)
-
 	return child
 }
 
-func (c *Container) verifyAcyclic() error {
-	visited := make(map[key]struct{})
-	for _, n := range c.nodes {
-		if err := detectCycles(n, c, nil /* path */, visited); err != nil {
-			return errWrapf(err, "cycle detected in dependency graph")
-		}
-	}
-
-	c.isVerifiedAcyclic = true
-	return nil
+// Children returns the children of this container in the order in which they
+// were created.
+func (c *Container) Children() []*Container {
+	children := make([]*Container, len(c.children))
+	copy(children, c.children)
+	return children
 }
 
-func (c *Container) provide(ctor interface{}, opts provideOptions) error {
-	n, err := newNode(
-		ctor,
-		nodeOptions{
-			ResultName:  opts.Name,
-			ResultGroup: opts.Group,
-			ResultAs:    opts.As,
-		},
-	)
-	if err != nil {
-		return err
+// Path returns the names of the containers from the root to this container,
+// separated by slashes. The root container is named "root". Given,
+//
+//   v1 := c.Child("api").Child("v1")
+//
+// The path of v1 is "root/api/v1".
+func (c *Container) Path() string {
+	if c.parent == nil {
+		return c.name
 	}
+	return c.parent.Path() + "/" + c.name
+}
 
-	keys, err := c.findAndValidateResults(n)
-	if err != nil {
-		return err
+// childPath returns the path of this container if it is a child container,
+// and an empty string otherwise.
+func (c *Container) childPath() string {
+	if c.parent == nil {
+		return ""
 	}
+	return c.Path()
+}
 
-	ctype := reflect.TypeOf(ctor)
-	if len(keys) == 0 {
-		return fmt.Errorf("%v must provide at least one non-error type", ctype)
+// Lookup finds a descendant of this container by its path relative to this
+// container. The path is made of the names of the containers separated by
+// slashes. If multiple children have the same name, the first one created is
+// used. Given the container above,
+//
+//   v1, ok := c.Lookup("api/v1")
+//
+// An empty path refers to the container itself.
+func (c *Container) Lookup(path string) (*Container, bool) {
+	if len(path) == 0 {
+		return c, true
+	}
+
+	cur := c
+	for _, name := range strings.Split(path, "/") {
+		var next *Container
+		for _, cc := range cur.children {
+			if cc.name == name {
+				next = cc
+				break
+			}
+		}
+		if next == nil {
+			return nil, false
+		}
+		cur = next
+	}
+	return cur, true
+}
+
+// OnDetach registers a function to be called when this container is detached
+// from its parent. Functions are called in the reverse order of their
+// registration. Functions registered with a root container are never called.
+func (c *Container) OnDetach(f func()) {
+	c.cleanups = append(c.cleanups, f)
+}
+
+// Detach removes this child container from its parent and releases the
+// values built in it and its descendants. The descendants of the container
+// are detached first, after which the functions registered with OnDetach are
+// called.
+//
+// Values built in a detached container are no longer reachable from its
+// parent. As such, a child whose exported values were already built cannot be
+// detached, but exported constructors which were not called yet are removed
+// from the parent. Detached containers may not be used to Provide, Decorate
+// or Invoke.
+func (c *Container) Detach() error {
+	if c.parent == nil {
+		return errors.New("cannot detach a root container")
+	}
+	if c.detached {
+		return nil
+	}
+	if err := c.errIfFrozen(); err != nil {
+		return err
+	}
+	if err := c.parent.errIfReadOnly(); err != nil {
+		return err
+	}
+	if err := c.parent.errIfSealed(); err != nil {
+		return err
+	}
+
+	p := c.parent
+	exported := make(map[*node]struct{})
+	for _, n := range c.nodes {
+		if n.container != p {
+			continue
+		}
+		if n.called {
+			return fmt.Errorf(
+				"cannot detach child container %q: values exported by %v were already built",
+				c.Path(), n.location)
+		}
+		exported[n] = struct{}{}
+	}
+
+	if len(exported) > 0 {
+		for k, providers := range p.providers {
+			var kept []*node
+			for _, n := range providers {
+				if _, ok := exported[n]; !ok {
+					kept = append(kept, n)
+				}
+			}
+			if len(kept) == 0 {
+				delete(p.providers, k)
+			} else {
+				p.providers[k] = kept
+			}
+		}
+	}
+
+	for i, cc := range p.children {
+		if cc == c {
+			p.children = append(p.children[:i:i], p.children[i+1:]...)
+			break
+		}
+	}
+
+	c.release()
+	return nil
+}
+
+// release calls the cleanup functions of this container and its descendants
+// and drops all references to their values.
+func (c *Container) release() {
+	for i := len(c.children) - 1; i >= 0; i-- {
+		c.children[i].release()
+	}
+	for i := len(c.cleanups) - 1; i >= 0; i-- {
+		c.cleanups[i]()
+	}
+
+	c.detached = true
+	c.providers = nil
+	c.nodes = nil
+	c.values = nil
+	c.groups = nil
+	c.keyedGroups = nil
+	c.decoratedElements = nil
+	c.decorators = nil
+	c.elementDecorators = nil
+	c.cleanups = nil
+}
+
+// errIfReadOnly returns an error if this container was detached from its
+// parent, created after it was sealed, or frozen.
+func (c *Container) errIfReadOnly() error {
+	if err := c.errIfUnusable(); err != nil {
+		return err
+	}
+	return c.errIfFrozen()
+}
+
+// errIfUnusable returns an error if this container was detached from its
+// parent or created after it was sealed.
+func (c *Container) errIfUnusable() error {
+	if c.createdSealed {
+		return errSealed{Path: c.Path(), Created: true}
+	}
+	if c.detached {
+		return fmt.Errorf("container %q was detached", c.Path())
+	}
+	return nil
+}
+
+// errIfFrozen returns an error if this container was frozen to create
+// request scopes from it or from one of its descendants.
+func (c *Container) errIfFrozen() error {
+	if c.frozen {
+		return fmt.Errorf("container %q is frozen: it is used by request scopes", c.Path())
+	}
+	return nil
+}
+
+func (c *Container) verifyAcyclic() error {
+	visited := make(map[key]struct{})
+	for _, n := range c.nodes {
+		if err := detectCycles(n, n.Scope(c), nil /* path */, visited); err != nil {
+			return errWrapf(err, "cycle detected in dependency graph")
+		}
+	}
+
+	c.isVerifiedAcyclic = true
+	return nil
+}
+
+func (c *Container) provide(ctor interface{}, opts provideOptions) ([]key, error) {
+	if opts.Priority != 0 {
+		return nil, errors.New("cannot use dig.Priority with constructors")
+	}
+
+	n, err := newNode(
+		ctor,
+		nodeOptions{
+			ResultName:  opts.Name,
+			ResultGroup: opts.Group,
+			ResultAs:    opts.As,
+			Location:    opts.Location,
+			ID:          opts.ID,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exported nodes are registered with the parent container, but their
+	// dependencies are still resolved from this container.
+	n.container, n.providedTo = c, c
+	if opts.Export && c.parent != nil {
+		n.container = c.parent
+	}
+	n.override = opts.Override
+	n.retry = opts.Retry
+	n.timeout = opts.Timeout
+	rc := n.container
+	if err := rc.errIfFrozen(); err != nil {
+		return nil, err
+	}
+
+	keys, err := rc.findAndValidateResults(n)
+	if err != nil {
+		return nil, err
+	}
+
+	ctype := reflect.TypeOf(ctor)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%v must provide at least one non-error type", ctype)
 	}
 
 	for k := range keys {
 		c.isVerifiedAcyclic = false
-		oldProviders := c.providers[k]
-		c.providers[k] = append(c.providers[k], n)
+		oldProviders := rc.providers[k]
+		rc.providers[k] = append(rc.providers[k], n)
 
 		if c.deferAcyclicVerification {
 			continue
 		}
-		if err := verifyAcyclic(c.getRoot(), n, k); err != nil {
-			c.providers[k] = oldProviders
-			return err
+		if err := verifyAcyclic(c, n, k); err != nil {
+			rc.providers[k] = oldProviders
+			return nil, err
 		}
 		c.isVerifiedAcyclic = true
 	}
 
 	c.nodes = append(c.nodes, n)
 
-	return nil
+	provided := make([]key, 0, len(keys))
+	for k := range keys {
+		provided = append(provided, k)
+	}
+	sortKeys(provided)
+	return provided, nil
 }
 
 // Builds a collection of all result types produced by this node.
@@ -662,10 +1501,11 @@ func (c *Container) findAndValidateResults(n *node) (map[key]struct{}, error) {
 	var err error
 	keyPaths := make(map[key]string)
 	walkResult(n.ResultList(), connectionVisitor{
-		c:        c.getRoot(),
-		n:        n,
-		err:      &err,
-		keyPaths: keyPaths,
+		c:             c,
+		n:             n,
+		err:           &err,
+		keyPaths:      keyPaths,
+		groupKeyPaths: make(map[key]string),
 	})
 
 	if err != nil {
@@ -679,142 +1519,417 @@ func (c *Container) findAndValidateResults(n *node) (map[key]struct{}, error) {
 	return keys, nil
 }
 
-func (c *Container) decorate(dtor interface{}, opts provideOptions) error {
+// DecoratorInfo describes a decorator in a chain of decorators. See
+// DecoratorChain.
+type DecoratorInfo struct {
+	// Identifier of the decorator.
+	ID NodeID
+
+	// Name of the decorator function and where it was defined.
+	Function string
+
+	// Path of the container the decorator was registered with.
+	Container string
+
+	// Priority of the decorator. See Priority.
+	Priority int
+}
+
+// DecoratorChain returns the decorators applied to the values of type t when
+// they are resolved from this container, in the order in which they are
+// applied. The dig.Name option selects a named value, and the dig.Group
+// option the element decorators of a value group. Other options are ignored.
+//
+// The decorators of the ancestors of the container are applied first. The
+// decorators registered with the same container are ordered by their
+// priority, and then by the order in which they were registered. Given,
+//
+//   c.Decorate(withLogging)
+//   c.Decorate(withMetrics, dig.Priority(1))
+//
+// withMetrics is applied first, and withLogging receives its result.
+func (c *Container) DecoratorChain(t reflect.Type, opts ...ProvideOption) []DecoratorInfo {
+	var options provideOptions
+	for _, o := range opts {
+		o.applyProvideOption(&options)
+	}
+
+	var chain []DecoratorInfo
+	if len(options.Group) > 0 {
+		for _, d := range c.getElementDecorators(key{t: t, group: options.Group}) {
+			chain = append(chain, DecoratorInfo{
+				ID:        d.id,
+				Function:  fmt.Sprint(d.location),
+				Container: d.container.Path(),
+				Priority:  d.priority,
+			})
+		}
+		return chain
+	}
+
+	for _, n := range c.getDecorators(key{t: t, name: options.Name}) {
+		chain = append(chain, DecoratorInfo{
+			ID:        n.id,
+			Function:  fmt.Sprint(n.location),
+			Container: n.container.Path(),
+			Priority:  n.priority,
+		})
+	}
+	return chain
+}
+
+func (c *Container) decorate(dtor interface{}, opts provideOptions) ([]key, error) {
+	if opts.Export {
+		return nil, errors.New("cannot use dig.Export with decorators")
+	}
+	if opts.Retry != nil {
+		return nil, errors.New("cannot use dig.Retry with decorators")
+	}
+	if opts.Timeout != 0 {
+		return nil, errors.New("cannot use dig.Timeout with decorators")
+	}
+	if len(opts.Group) > 0 {
+		return c.decorateElements(dtor, opts)
+	}
+
 	n, err := newNode(
 		dtor,
 		nodeOptions{
-			ResultName:  opts.Name,
-			ResultGroup: opts.Group,
-			ResultAs:    opts.As,
+			ResultName: opts.Name,
+			ResultAs:   opts.As,
+			Location:   opts.Location,
+			ID:         opts.ID,
 		},
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	// Decorated values are resolved from and stored into this container so
+	// that they are only visible from its subtree.
+	n.container, n.providedTo = c, c
+	n.priority = opts.Priority
 
-	dtype := reflect.TypeOf(dtor)
+	keys, err := decoratedKeys(n.resultList)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%v must decorate at least one non-error type", n.ctype)
+	}
 
-	// Check if all the result types exist among the input types
-	inTypes := make(map[key]struct{})
-	for i := 0; i < dtype.NumIn(); i++ {
-		in := dtype.In(i)
-		if IsIn(in) {
-			for j := 0; j < in.NumField(); j++ {
-				t := in.Field(j).Type
-				//Exclude embedded In type
-				if IsIn(t) {
-					continue
-				}
-				name := in.Field(j).Tag.Get(_nameTag)
-				group := in.Field(j).Tag.Get(_groupTag)
-				if name != "" && group != "" {
-					return errors.New("cannot use name tags and group tags together")
-				}
-				if group != "" {
-					if _, ok := inTypes[key{t.Elem(), name, group}]; ok {
-						return fmt.Errorf("cannot provide %v multple times in decorator", t)
-					}
-					inTypes[key{t.Elem(), name, group}] = struct{}{}
-				} else {
-					if _, ok := inTypes[key{t, name, group}]; ok {
-						return fmt.Errorf("cannot provide %v multple times in decorator", t)
-					}
-					inTypes[key{t, name, group}] = struct{}{}
-				}
+	// A decorator receives the values it decorates, so dig.Name applies to
+	// its positional parameters as well as its results.
+	if len(opts.Name) > 0 {
+		for i, p := range n.paramList.Params {
+			ps, ok := p.(paramSingle)
+			if !ok || len(ps.Name) > 0 {
+				continue
+			}
+			if _, ok := keys[key{name: opts.Name, t: ps.Type}]; ok {
+				ps.Name = opts.Name
+				n.paramList.Params[i] = ps
 			}
-		} else {
-			inTypes[key{t: in}] = struct{}{}
 		}
 	}
-	outTypes := make(map[key]struct{})
-	for i := 0; i < dtype.NumOut(); i++ {
-		out := dtype.Out(i)
-		if IsOut(out) {
-			for j := 0; j < out.NumField(); j++ {
-				t := out.Field(j).Type
-				//Exclude embedded Out type
-				if IsOut(t) {
-					continue
-				}
-				name := out.Field(j).Tag.Get(_nameTag)
-				group := out.Field(j).Tag.Get(_groupTag)
-				if name != "" && group != "" {
-					return errors.New("cannot use name tags and group tags together")
-				}
-				if _, ok := outTypes[key{t, name, group}]; ok {
-					return fmt.Errorf("cannot provide %v multple times in decorator", t)
-				}
-				outTypes[key{t, name, group}] = struct{}{}
+
+	// The dependencies of the decorator are its parameters other than the
+	// values it decorates.
+	inKeys := make(map[key]struct{})
+	deps := paramList{ctype: n.paramList.ctype}
+	walkParam(n.paramList, paramVisitorFunc(func(p param) bool {
+		switch p := p.(type) {
+		case paramSingle:
+			k := key{name: p.Name, t: p.Type}
+			inKeys[k] = struct{}{}
+			if _, ok := keys[k]; ok {
+				return false
 			}
-		} else {
-			outTypes[key{t: out}] = struct{}{}
+		case paramGroupedSlice:
+			// Decorators can't decorate value groups as a whole, so the
+			// value groups they consume are always dependencies.
+		default:
+			return true
 		}
-	}
+		deps.Params = append(deps.Params, p)
+		return false
+	}))
 
-	for k := range outTypes {
-		if _, ok := inTypes[k]; !ok {
-			return errors.New("the result types, with the exception of error, must be present among the input parameters")
+	decorated := sortedKeys(keys)
+	for _, k := range decorated {
+		// Values decorated as the interfaces given to dig.As are replaced
+		// with the decorated value, so they need not be parameters.
+		if _, ok := inKeys[k]; !ok && !keys[k] {
+			return nil, fmt.Errorf("cannot decorate %v: decorators must accept the values they decorate as parameters", k)
+		}
+		// Decorators are called from this container, so the values they
+		// decorate must be visible from it.
+		if c.getContainer(k) == nil {
+			return nil, fmt.Errorf("cannot decorate %v: it was not provided to the container or its ancestors", k)
 		}
-		delete(inTypes, k)
-	}
 
-	params := []param{}
-	for k := range inTypes {
-		if k.group != "" {
-			params = append(params, paramGroupedSlice{k.group, reflect.SliceOf(k.t)})
-		} else {
-			params = append(params, paramSingle{
-				Name: k.name,
-				Type: k.t,
-			})
+		dn := *n
+		dn.paramList = deps
+		if err := verifyAcyclic(c, &dn, k); err != nil {
+			return nil, err
 		}
 	}
 
-	for k := range outTypes {
-		found := false
-		// Checking for the decorator output's existence in the sub graph with the
-		// current container as root.
-		if _, ok := c.providers[k]; !ok {
-			var cont []*Container
-			cont = append(cont, c.children...)
-			for !found && !(len(cont) == 0) {
-				v := cont[0]
-				cont = cont[1:]
-				if _, ok := v.providers[k]; !ok {
-					cont = append(cont, v.children...)
-				} else {
-					found = true
-				}
+	for k := range keys {
+		ds := append(c.decorators[k], n)
+		sort.SliceStable(ds, func(i, j int) bool {
+			return ds[i].priority > ds[j].priority
+		})
+		c.decorators[k] = ds
+	}
+	return decorated, nil
+}
+
+// decoratedKeys returns the keys of the values replaced by a decorator with
+// the given results. Keys of the interfaces given to dig.As map to true.
+func decoratedKeys(rl resultList) (map[key]bool, error) {
+	keys := make(map[key]bool)
+	var err error
+	walkResult(rl, resultVisitorFunc(func(res result) bool {
+		if err != nil {
+			return false
+		}
+		switch r := res.(type) {
+		case resultSingle:
+			k := key{name: r.Name, t: r.Type}
+			if _, ok := keys[k]; ok {
+				err = fmt.Errorf("cannot decorate %v more than once in the same decorator", k)
+				return false
 			}
-		} else {
-			found = true
+			keys[k] = false
+			for _, t := range r.As {
+				keys[key{name: r.Name, t: t}] = true
+			}
+		case resultGrouped:
+			err = fmt.Errorf("cannot decorate %v: use dig.Group to decorate the values of a value group",
+				key{group: r.Group, t: r.Type})
+			return false
 		}
-		if !found {
-			return errors.New("decorator must be declared in the scope of the node's container or its ancestors')")
+		return true
+	}))
+	return keys, err
+}
+
+// sortedKeys returns the given keys ordered by their string representation.
+func sortedKeys(keys map[key]bool) []key {
+	sorted := make([]key, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sortKeys(sorted)
+	return sorted
+}
+
+// sortKeys orders the given keys by their string representation.
+func sortKeys(keys []key) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+}
+
+// decorateElements registers a decorator which is applied to each value of
+// the value group named by opts.Group.
+func (c *Container) decorateElements(dtor interface{}, opts provideOptions) ([]key, error) {
+	g, err := parseGroupString(opts.Group)
+	if err != nil {
+		return nil, errWrapf(err, "cannot parse group %q", opts.Group)
+	}
+	switch {
+	case len(g.Key) > 0 || g.Soft || g.Min > 0 || g.Max > 0:
+		return nil, fmt.Errorf("cannot use options other than flatten with element decorators: "+
+			"group %q was requested", opts.Group)
+	case len(opts.As) > 0:
+		return nil, errors.New("cannot use dig.As with element decorators")
+	}
+
+	d, err := newElementDecorator(dtor, g)
+	if err != nil {
+		return nil, err
+	}
+	d.container = c
+	d.priority = opts.Priority
+	d.id = opts.ID
+	if opts.Location != nil {
+		d.location = opts.Location
+	}
+
+	k := key{t: d.Type, group: g.Name}
+	if err := verifyAcyclic(c, d, k); err != nil {
+		return nil, err
+	}
+
+	ds := append(c.elementDecorators[k], d)
+	sort.SliceStable(ds, func(i, j int) bool {
+		return ds[i].priority > ds[j].priority
+	})
+	c.elementDecorators[k] = ds
+	c.dropDecoratedElements(k)
+	return []key{k}, nil
+}
+
+// dropDecoratedElements drops the values of the group k decorated by this
+// container and its descendants, so that they are decorated again by their
+// current element decorators.
+func (c *Container) dropDecoratedElements(k key) {
+	for ek := range c.decoratedElements {
+		if ek.key == k {
+			delete(c.decoratedElements, ek)
 		}
+	}
+	for _, cc := range c.children {
+		cc.dropDecoratedElements(k)
+	}
+}
 
-		if len(params) > 0 {
-			c.isVerifiedAcyclic = false
-			oldParams := n.paramList.Params
-			oldProviders := c.providers[k]
-			for _, p := range c.providers[k] {
-				params = append(params, p.paramList.Params...)
-			}
-			n.paramList.Params = params
-			c.providers[k] = append([]*node{n}, c.providers[k]...)
-			if err := verifyAcyclic(c.getRoot(), n, k); err != nil {
-				c.providers[k] = oldProviders
-				return err
-			}
-			c.providers[k] = oldProviders
-			n.paramList.Params = oldParams
-			c.isVerifiedAcyclic = true
+// elementDecorator is a decorator which is applied to each value of a value
+// group individually. Its first parameter is the value being decorated, and
+// its remaining parameters are built from the container.
+//
+// It either returns a single value which replaces the decorated value, or if
+// flattened, a slice of values which replace it. A flattened decorator may
+// therefore remove values from the group by returning an empty slice.
+type elementDecorator struct {
+	dtor interface{}
+
+	// Location where this function was defined.
+	location *digreflect.Func
+
+	// Container with which this decorator was registered.
+	container *Container
+
+	// Type of the values of the group.
+	Type reflect.Type
+
+	// Whether the decorator returns a slice of values.
+	Flatten bool
+
+	// Type information about the dependencies of the decorator, that is,
+	// all of its parameters except the decorated value.
+	deps paramList
+
+	// Priority of the decorator among the element decorators of the same
+	// value group registered with its container.
+	priority int
+
+	// Identifier of the decorator.
+	id NodeID
+
+	// Time at which the decorator was first called, and the time spent in
+	// all of its calls.
+	startedAt time.Time
+	duration  time.Duration
+}
+
+func newElementDecorator(dtor interface{}, g groupOptions) (*elementDecorator, error) {
+	dtype := reflect.TypeOf(dtor)
+	if dtype.NumIn() == 0 || IsIn(dtype.In(0)) {
+		return nil, errors.New("element decorators must accept the decorated value as their first parameter")
+	}
+	if n := dtype.NumOut(); n == 0 || n > 2 || (n == 2 && !isError(dtype.Out(1))) {
+		return nil, errors.New("element decorators must return the decorated value, and optionally an error")
+	}
+
+	t := dtype.In(0)
+	want := t
+	if g.Flatten {
+		want = reflect.SliceOf(t)
+	}
+	if out := dtype.Out(0); out != want {
+		return nil, fmt.Errorf("element decorators must return %v to decorate %v: got %v", want, t, out)
+	}
+
+	pl, err := newParamList(dtype)
+	if err != nil {
+		return nil, err
+	}
+	pl.Params = pl.Params[1:]
+
+	return &elementDecorator{
+		dtor:     dtor,
+		location: digreflect.InspectFunc(dtor),
+		Type:     t,
+		Flatten:  g.Flatten,
+		deps:     pl,
+	}, nil
+}
+
+// Decorate calls the decorator on v, and returns the values which replace
+// it.
+func (d *elementDecorator) Decorate(c containerStore, v reflect.Value) ([]reflect.Value, error) {
+	if err := shallowCheckDependencies(c, d.deps); err != nil {
+		return nil, errMissingDependencies{
+			Func:   d.location,
+			Path:   d.container.childPath(),
+			Reason: err,
 		}
-		c.decorators[k] = append(c.decorators[k], n)
 	}
-	return nil
+	args, err := d.deps.BuildList(c)
+	if err != nil {
+		return nil, errArgumentsFailed{
+			Func:   d.location,
+			Path:   d.container.childPath(),
+			Reason: err,
+		}
+	}
+
+	results, err := d.call(c, append([]reflect.Value{v}, args...))
+	if err != nil {
+		return nil, errCallFailed(d.location, d.container.childPath(), err)
+	}
+
+	if !d.Flatten {
+		return results[:1], nil
+	}
+	out := make([]reflect.Value, results[0].Len())
+	for i := range out {
+		out[i] = results[0].Index(i)
+	}
+	return out, nil
 }
 
+// call calls the decorator with the given arguments, reporting the call to the
+// observer of c, if any, and adding its duration to the timing of d. The
+// error returned by the decorator, if any, is returned along with its
+// results.
+func (d *elementDecorator) call(c containerStore, args []reflect.Value) ([]reflect.Value, error) {
+	o := observerOf(c)
+	path := d.container.Path()
+	if o != nil {
+		o.Observe(ConstructorStartEvent{ID: d.id, Func: d.location, Container: path})
+	}
+
+	clock := clockOf(c)
+	start := clock()
+	results, err := callFunc(reflect.ValueOf(d.dtor), args, d.container.recoverPanics)
+	dur := clock().Sub(start)
+	if d.startedAt.IsZero() {
+		d.startedAt = start
+	}
+	d.duration += dur
+	if err == nil && len(results) == 2 {
+		err, _ = results[1].Interface().(error)
+	}
+
+	if o != nil {
+		o.Observe(ConstructorFinishEvent{
+			ID:        d.id,
+			Func:      d.location,
+			Container: path,
+			Duration:  dur,
+			Err:       err,
+		})
+	}
+	return results, err
+}
+
+func (d *elementDecorator) Location() *digreflect.Func { return d.location }
+func (d *elementDecorator) ContainerPath() string      { return d.container.childPath() }
+func (d *elementDecorator) ParamList() paramList       { return d.deps }
+
 // Visits the results of a node and compiles a collection of all the keys
 // produced by that node.
 type connectionVisitor struct {
@@ -834,6 +1949,11 @@ type connectionVisitor struct {
 	// constructor.
 	keyPaths map[key]string
 
+	// Map of keyed group values provided to the path that provided them.
+	// These keys hold both the group name and the key of the value, and are
+	// used to detect values submitted to a group with the same key.
+	groupKeyPaths map[key]string
+
 	// We track the path to the current result here. For example, this will
 	// be, ["[1]", "Foo", "Bar"] when we're visiting Bar in,
 	//
@@ -890,23 +2010,86 @@ func (cv connectionVisitor) Visit(res result) resultVisitor {
 		// we don't really care about the path for this since conflicts are
 		// okay for group results. We'll track it for the sake of having a
 		// value there.
-		k := key{group: r.Group, t: r.Type}
-		cv.keyPaths[k] = path
+		for _, t := range r.Types() {
+			k := key{group: r.Group, t: t}
+			cv.keyPaths[k] = path
+
+			if len(r.Key) > 0 {
+				if err := cv.checkGroupKey(k, r.Key, path); err != nil {
+					*cv.err = err
+					return nil
+				}
+				cv.groupKeyPaths[key{group: r.Group, name: r.Key, t: t}] = path
+			}
+		}
 	}
 
 	return cv
 }
 
+// checkGroupKey verifies that no other value was submitted to the group with
+// the same key.
+func (cv connectionVisitor) checkGroupKey(k key, mapKey string, path string) error {
+	if conflict, ok := cv.groupKeyPaths[key{group: k.group, name: mapKey, t: k.t}]; ok {
+		return fmt.Errorf(
+			"cannot provide %v with key %q from %v: already provided by %v",
+			k, mapKey, path, conflict)
+	}
+
+	var cons []string
+	providers := cv.c.getGroupProviders(k.group, k.t)
+	for _, n := range cv.c.getDescendantNodes(k) {
+		providers = append(providers, n)
+	}
+	for _, p := range providers {
+		walkResult(p.ResultList(), resultVisitorFunc(func(res result) bool {
+			rg, ok := res.(resultGrouped)
+			if !ok || rg.Group != k.group || rg.Key != mapKey {
+				return true
+			}
+			for _, t := range rg.Types() {
+				if t == k.t {
+					cons = append(cons, fmt.Sprint(p.Location())+inContainer(p.ContainerPath()))
+					return false
+				}
+			}
+			return true
+		}))
+	}
+	if len(cons) > 0 {
+		return fmt.Errorf(
+			"cannot provide %v with key %q from %v: already provided by %v",
+			k, mapKey, path, strings.Join(cons, "; "))
+	}
+
+	return nil
+}
+
 func (cv connectionVisitor) checkKey(k key, path string) error {
 	if conflict, ok := cv.keyPaths[k]; ok {
 		return fmt.Errorf(
 			"cannot provide %v from %v: already provided by %v",
 			k, path, conflict)
 	}
-	if ps := cv.c.getValueProviders(k.name, k.t); len(ps) > 0 {
+	// Values provided to this container conflict with values provided to
+	// its ancestors, which are visible here, unless they override them. They
+	// also conflict with values provided to its descendants which don't
+	// override them, since those descendants would see two providers for k.
+	var ps []provider
+	if cv.n.override {
+		ps = cv.c.getProviders(k)
+	} else {
+		ps = cv.c.getValueProviders(k.name, k.t)
+	}
+	for _, n := range cv.c.getDescendantNodes(k) {
+		if !n.override {
+			ps = append(ps, n)
+		}
+	}
+	if len(ps) > 0 {
 		cons := make([]string, len(ps))
 		for i, p := range ps {
-			cons[i] = fmt.Sprint(p.Location())
+			cons[i] = fmt.Sprint(p.Location()) + inContainer(p.ContainerPath())
 		}
 
 		return fmt.Errorf(
@@ -930,12 +2113,50 @@ type node struct {
 	// Location where this function was defined.
 	location *digreflect.Func
 
-	// id uniquely identifies the constructor that produces a node.
-	id dot.CtorID
+	// Container with which this node is registered. Values produced by the
+	// node are submitted into this container.
+	container *Container
+
+	// Container to which the constructor was provided. The dependencies of
+	// the node are resolved from this container. This is a child of
+	// container if the constructor was exported.
+	providedTo *Container
+
+	// Whether the values produced by this node override the values provided
+	// to the ancestors of container.
+	override bool
+
+	// Priority of a decorator among the decorators of the same values
+	// registered with its container.
+	priority int
+
+	// How the constructor is retried if it fails, if at all.
+	retry *RetryPolicy
+
+	// Maximum duration of a call to the constructor, or 0 if there is none.
+	timeout time.Duration
+
+	// Whether the dependencies of the constructor are known to be
+	// provided. This is only set once its container is sealed.
+	depsChecked bool
+
+	// id uniquely identifies the node among the nodes provided to the
+	// containers of the same tree.
+	id NodeID
 
 	// Whether the constructor owned by this node was already called.
 	called bool
 
+	// Whether the constructor owned by this node is being called, that is,
+	// its dependencies are being built.
+	calling bool
+
+	// When the constructor was called, and how long it took, excluding the
+	// time spent building its dependencies. startedAt is zero if the
+	// constructor was never called.
+	startedAt time.Time
+	duration  time.Duration
+
 	// Type information about constructor parameters.
 	paramList paramList
 
@@ -943,18 +2164,38 @@ type node struct {
 	resultList resultList
 }
 
+// NodeID identifies a constructor or a decorator among those provided to a
+// container and its descendants. Each call to Provide or Decorate gets a new
+// ID, even if the same function is given several times. IDs are assigned in
+// order, starting at 1, so they are the same across runs of a program which
+// provides its functions in the same order.
+type NodeID uint64
+
+// newNodeID returns the identifier of the next function given to this
+// container or any container of the same tree.
+func (c *Container) newNodeID() NodeID {
+	root := c.getRoot()
+	root.lastNodeID++
+	return root.lastNodeID
+}
+
 type nodeOptions struct {
 	// If specified, all values produced by this node have the provided name
 	// belong to the specified value group or implement any of the interfaces.
 	ResultName  string
 	ResultGroup string
 	ResultAs    []interface{}
+
+	// Location of the constructor, if already known.
+	Location *digreflect.Func
+
+	// Identifier of the node.
+	ID NodeID
 }
 
 func newNode(ctor interface{}, opts nodeOptions) (*node, error) {
 	cval := reflect.ValueOf(ctor)
 	ctype := cval.Type()
-	cptr := cval.Pointer()
 
 	params, err := newParamList(ctype)
 	if err != nil {
@@ -973,11 +2214,16 @@ func newNode(ctor interface{}, opts nodeOptions) (*node, error) {
 		return nil, err
 	}
 
+	location := opts.Location
+	if location == nil {
+		location = digreflect.InspectFunc(ctor)
+	}
+
 	return &node{
 		ctor:       ctor,
 		ctype:      ctype,
-		location:   digreflect.InspectFunc(ctor),
-		id:         dot.CtorID(cptr),
+		location:   location,
+		id:         opts.ID,
 		paramList:  params,
 		resultList: results,
 	}, err
@@ -986,7 +2232,23 @@ func newNode(ctor interface{}, opts nodeOptions) (*node, error) {
 func (n *node) Location() *digreflect.Func { return n.location }
 func (n *node) ParamList() paramList       { return n.paramList }
 func (n *node) ResultList() resultList     { return n.resultList }
-func (n *node) ID() dot.CtorID             { return n.id }
+func (n *node) ID() dot.CtorID             { return dot.CtorID(n.id) }
+
+func (n *node) ContainerPath() string {
+	if n.providedTo == nil {
+		return ""
+	}
+	return n.providedTo.childPath()
+}
+
+// Scope returns the container from which the dependencies of this node are
+// resolved. This defaults to c if the node was not provided to a container.
+func (n *node) Scope(c containerStore) containerStore {
+	if n.providedTo == nil {
+		return c
+	}
+	return n.providedTo
+}
 
 // Call calls this node's constructor if it hasn't already been called and
 // injects any values produced by it into the provided container.
@@ -994,32 +2256,97 @@ func (n *node) Call(c containerStore) error {
 	if n.called {
 		return nil
 	}
-	if err := shallowCheckDependencies(c, n.paramList); err != nil {
-		return errMissingDependencies{
-			Func:   n.location,
-			Reason: err,
+
+	var cw containerWriter = c
+	if n.container != nil {
+		cw = n.container
+	}
+	c = n.Scope(c)
+
+	if !n.depsChecked {
+		if err := shallowCheckDependencies(c, n.paramList); err != nil {
+			return errMissingDependencies{
+				Func:   n.location,
+				Path:   n.ContainerPath(),
+				Reason: err,
+			}
 		}
 	}
+	n.calling = true
 	args, err := n.paramList.BuildList(c)
+	n.calling = false
 	if err != nil {
 		return errArgumentsFailed{
 			Func:   n.location,
+			Path:   n.ContainerPath(),
 			Reason: err,
 		}
 	}
 	if n.called {
 		return nil
 	}
-	receiver := newStagingContainerWriter()
-	results := reflect.ValueOf(n.ctor).Call(args)
-	if err := n.resultList.ExtractList(receiver, results); err != nil {
-		return errConstructorFailed{Func: n.location, Reason: err}
+	n.startedAt = clockOf(c)()
+	receiver, d, err := n.callWithRetries(c, args)
+	n.duration = d
+	if err != nil {
+		return errCallFailed(n.location, n.ContainerPath(), err)
 	}
-	receiver.Commit(c)
+	n.observeGroups(observerOf(c), receiver)
+	receiver.Commit(cw)
 	n.called = true
+	if j := n.container.journal(); j != nil {
+		j.record(func() { n.called = false })
+	}
 	return nil
 }
 
+// callConstructor calls the constructor of n with the given arguments and
+// extracts its results into sr, reporting the call to the observer of c, if
+// any. It returns the time spent in the constructor according to the clock of
+// c.
+func (n *node) callConstructor(c containerStore, args []reflect.Value, sr *stagingContainerWriter) (time.Duration, error) {
+	var (
+		o             Observer
+		recoverPanics bool
+		clock         = time.Now
+	)
+	if cc := containerOf(c); cc != nil {
+		o, recoverPanics, clock = cc.observer, cc.recoverPanics, cc.clock
+	}
+
+	var path string
+	if o != nil {
+		path = n.containerFullPath()
+		o.Observe(ConstructorStartEvent{ID: n.id, Func: n.location, Container: path})
+	}
+
+	start := clock()
+	var (
+		results []reflect.Value
+		err     error
+	)
+	if n.timeout > 0 {
+		results, err = n.callWithTimeout(c, args, recoverPanics)
+	} else {
+		results, err = callFunc(reflect.ValueOf(n.ctor), args, recoverPanics)
+	}
+	d := clock().Sub(start)
+	if err == nil {
+		err = n.resultList.ExtractList(sr, results)
+	}
+
+	if o != nil {
+		o.Observe(ConstructorFinishEvent{
+			ID:        n.id,
+			Func:      n.location,
+			Container: path,
+			Duration:  d,
+			Err:       err,
+		})
+	}
+	return d, err
+}
+
 // Checks if a field of an In struct is optional.
 func isFieldOptional(f reflect.StructField) (bool, error) {
 	tag := f.Tag.Get(_optionalTag)
@@ -1042,12 +2369,30 @@ func isFieldOptional(f reflect.StructField) (bool, error) {
 func shallowCheckDependencies(c containerStore, p param) error {
 	var missing errMissingManyTypes
 	var addMissingNodes []*dot.Param
+	var cardinality error
 	walkParam(p, paramVisitorFunc(func(p param) bool {
+		if pg, ok := p.(paramGroupedSlice); ok {
+			// A group without any providers will be empty.
+			if pg.Min > 0 && cardinality == nil &&
+				len(c.getGroupProviders(pg.Group, pg.Type.Elem())) == 0 {
+				cardinality = errGroupCardinality{
+					Key: key{group: pg.Group, t: pg.Type.Elem()},
+					Min: pg.Min,
+					Max: pg.Max,
+				}
+			}
+			return true
+		}
+
 		ps, ok := p.(paramSingle)
 		if !ok {
 			return true
 		}
 
+		// Values given to a RequestScope don't have providers.
+		if _, ok := c.getValue(ps.Name, ps.Type); ok {
+			return true
+		}
 		if ns := c.getValueProviders(ps.Name, ps.Type); len(ns) == 0 && !ps.Optional {
 			missing = append(missing, newErrMissingType(c, key{name: ps.Name, t: ps.Type}))
 			addMissingNodes = append(addMissingNodes, ps.DotParam()...)
@@ -1059,7 +2404,7 @@ func shallowCheckDependencies(c containerStore, p param) error {
 	if len(missing) > 0 {
 		return missing
 	}
-	return nil
+	return cardinality
 }
 
 // stagingContainerWriter is a containerWriter that records the changes that
@@ -1067,6 +2412,7 @@ func shallowCheckDependencies(c containerStore, p param) error {
 type stagingContainerWriter struct {
 	values      map[key]reflect.Value
 	groups      map[key][]reflect.Value
+	keyedGroups map[key]map[string]reflect.Value
 	isDecorated map[key]bool
 }
 
@@ -1074,8 +2420,9 @@ var _ containerWriter = (*stagingContainerWriter)(nil)
 
 func newStagingContainerWriter() *stagingContainerWriter {
 	return &stagingContainerWriter{
-		values: make(map[key]reflect.Value),
-		groups: make(map[key][]reflect.Value),
+		values:      make(map[key]reflect.Value),
+		groups:      make(map[key][]reflect.Value),
+		keyedGroups: make(map[key]map[string]reflect.Value),
 	}
 }
 
@@ -1088,6 +2435,14 @@ func (sr *stagingContainerWriter) submitGroupedValue(group string, t reflect.Typ
 	sr.groups[k] = append(sr.groups[k], v)
 }
 
+func (sr *stagingContainerWriter) submitKeyedGroupedValue(group, mapKey string, t reflect.Type, v reflect.Value) {
+	k := key{t: t, group: group}
+	if sr.keyedGroups[k] == nil {
+		sr.keyedGroups[k] = make(map[string]reflect.Value)
+	}
+	sr.keyedGroups[k][mapKey] = v
+}
+
 // Commit commits the received results to the provided containerWriter.
 func (sr *stagingContainerWriter) Commit(cw containerWriter) {
 	for k, v := range sr.values {
@@ -1099,6 +2454,12 @@ func (sr *stagingContainerWriter) Commit(cw containerWriter) {
 			cw.submitGroupedValue(k.group, k.t, v)
 		}
 	}
+
+	for k, vs := range sr.keyedGroups {
+		for mapKey, v := range vs {
+			cw.submitKeyedGroupedValue(k.group, mapKey, k.t, v)
+		}
+	}
 }
 
 type byTypeName []reflect.Type
@@ -1115,9 +2476,9 @@ func (bs byTypeName) Swap(i int, j int) {
 	bs[i], bs[j] = bs[j], bs[i]
 }
 
-func shuffledCopy(rand *rand.Rand, items []reflect.Value) []reflect.Value {
+func shuffledCopy(perm func(int) []int, items []reflect.Value) []reflect.Value {
 	newItems := make([]reflect.Value, len(items))
-	for i, j := range rand.Perm(len(items)) {
+	for i, j := range perm(len(items)) {
 		newItems[i] = items[j]
 	}
 	return newItems
@@ -29,7 +29,9 @@ import (
 	"math/rand"
 	"os"
 	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -990,12 +992,408 @@ func TestChildren(t *testing.T) {
 		require.NoError(t, cc[2].Provide(func() *bytes.Buffer {
 			b = &bytes.Buffer{}
 			return b
-		}), "provide failed")
+		}, Export(true)), "provide failed")
 		require.NoError(t, c.Invoke(func(got *bytes.Buffer) {
 			require.NotNil(t, got, "invoke got nil buffer")
 			require.True(t, got == b, "invoke got wrong buffer")
 		}), "invoke failed")
 	})
+
+	t.Run("child providers are private by default", func(t *testing.T) {
+		c := New()
+
+		require.NoError(t, c.Child("child").Provide(func() *bytes.Buffer {
+			panic("this function must not be called")
+		}), "provide failed")
+
+		err := c.Invoke(func(*bytes.Buffer) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`missing dependencies for function "go.uber.org/dig".TestChildren\S+`,
+			`type \*bytes.Buffer is not in the container, did you mean to Provide it\?`,
+		)
+	})
+
+	t.Run("siblings provide the same private types", func(t *testing.T) {
+		type helper struct{ name string }
+		type (
+			A struct{ h *helper }
+			B struct{ h *helper }
+		)
+
+		c := New()
+		ca, cb := c.Child("a"), c.Child("b")
+
+		require.NoError(t, ca.Provide(func() *helper { return &helper{"a"} }), "provide failed")
+		require.NoError(t, cb.Provide(func() *helper { return &helper{"b"} }), "provide failed")
+		require.NoError(t, ca.Provide(func(h *helper) A { return A{h} }, Export(true)), "provide failed")
+		require.NoError(t, cb.Provide(func(h *helper) B { return B{h} }, Export(true)), "provide failed")
+
+		require.NoError(t, c.Invoke(func(a A, b B) {
+			assert.Equal(t, "a", a.h.name)
+			assert.Equal(t, "b", b.h.name)
+		}), "invoke failed")
+	})
+
+	t.Run("exported types conflict with the parent", func(t *testing.T) {
+		c := New()
+
+		require.NoError(t, c.Provide(func() *bytes.Buffer {
+			panic("this function must not be called")
+		}), "provide failed")
+
+		err := c.Child("child").Provide(func() *bytes.Buffer {
+			panic("this function must not be called")
+		}, Export(true))
+		require.Error(t, err, "provide must fail")
+		assertErrorMatches(t, err,
+			`cannot provide \*bytes.Buffer from \[0\]:`,
+			`already provided by "go.uber.org/dig".TestChildren\S+`,
+		)
+	})
+
+	t.Run("override parent providers", func(t *testing.T) {
+		type clock struct{ name string }
+		type service struct{ c *clock }
+
+		c := New()
+		require.NoError(t, c.Provide(func() *clock { return &clock{"real"} }), "provide failed")
+		require.NoError(t, c.Provide(func(c *clock) *service { return &service{c} }), "provide failed")
+
+		// Build the parent's clock before the child is created.
+		require.NoError(t, c.Invoke(func(c *clock) {
+			assert.Equal(t, "real", c.name)
+		}), "invoke failed")
+
+		child := c.Child("test")
+		sibling := c.Child("sibling")
+		require.NoError(t, child.Provide(func() *clock { return &clock{"fake"} }, Override(true)),
+			"provide failed")
+
+		require.NoError(t, child.Invoke(func(c *clock) {
+			assert.Equal(t, "fake", c.name)
+		}), "invoke failed")
+		require.NoError(t, child.Child("grandchild").Invoke(func(c *clock) {
+			assert.Equal(t, "fake", c.name)
+		}), "invoke failed")
+		require.NoError(t, sibling.Invoke(func(c *clock) {
+			assert.Equal(t, "real", c.name)
+		}), "invoke failed")
+
+		// Constructors provided to the parent keep receiving the parent's
+		// values.
+		require.NoError(t, child.Invoke(func(s *service) {
+			assert.Equal(t, "real", s.c.name)
+		}), "invoke failed")
+	})
+
+	t.Run("parent providers after an override", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+
+		require.NoError(t, child.Provide(func() string { return "child" }, Override(true)), "provide failed")
+		require.NoError(t, c.Provide(func() string { return "parent" }), "provide failed")
+
+		require.NoError(t, child.Invoke(func(s string) {
+			assert.Equal(t, "child", s)
+		}), "invoke failed")
+		require.NoError(t, c.Invoke(func(s string) {
+			assert.Equal(t, "parent", s)
+		}), "invoke failed")
+	})
+
+	t.Run("override conflicts within the child", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+
+		require.NoError(t, c.Provide(func() string { return "parent" }), "provide failed")
+		require.NoError(t, child.Provide(func() string { return "child" }, Override(true)), "provide failed")
+		err := child.Provide(func() string { return "child" }, Override(true))
+		require.Error(t, err, "provide must fail")
+		assertErrorMatches(t, err,
+			`cannot provide string from \[0\]:`,
+			`already provided by "go.uber.org/dig".TestChildren\S+`,
+		)
+	})
+
+	t.Run("invoke on a child applies its decorators", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() string { return "value" }), "provide failed")
+		require.NoError(t, c.Decorate(func(s string) string { return "root(" + s + ")" }), "decorate failed")
+
+		// The value is built and decorated in the parent first.
+		require.NoError(t, c.Invoke(func(s string) {
+			assert.Equal(t, "root(value)", s)
+		}), "invoke failed")
+
+		child := c.Child("child")
+		require.NoError(t, child.Decorate(func(s string) string { return "child(" + s + ")" }), "decorate failed")
+
+		require.NoError(t, child.Invoke(func(s string) {
+			assert.Equal(t, "child(root(value))", s)
+		}), "invoke failed")
+		require.NoError(t, c.Invoke(func(s string) {
+			assert.Equal(t, "root(value)", s)
+		}), "invoke failed")
+	})
+
+	t.Run("decorators apply within their subtree", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() string { return "logger" }), "provide failed")
+
+		a := c.Child("a")
+		a1 := a.Child("a1")
+		b := c.Child("b")
+		require.NoError(t, a.Decorate(func(s string) string { return "a(" + s + ")" }), "decorate failed")
+		require.NoError(t, b.Decorate(func(s string) string { return "b(" + s + ")" }), "decorate failed")
+
+		for _, tt := range []struct {
+			c    *Container
+			want string
+		}{
+			{c: a1, want: "a(logger)"},
+			{c: b, want: "b(logger)"},
+			{c: a, want: "a(logger)"},
+			{c: c, want: "logger"},
+		} {
+			require.NoError(t, tt.c.Invoke(func(s string) {
+				assert.Equal(t, tt.want, s, "unexpected value in %q", tt.c.Path())
+			}), "invoke failed")
+		}
+	})
+
+	t.Run("decorators of descendants don't apply", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() int { return 1 }), "provide failed")
+
+		child := c.Child("child")
+		grandchild := child.Child("grandchild")
+		require.NoError(t, grandchild.Provide(func() int { return 10 }, Override(true)), "provide failed")
+
+		var called bool
+		require.NoError(t, grandchild.Decorate(func(i int) int {
+			called = true
+			return i + 1
+		}), "decorate failed")
+
+		require.NoError(t, child.Invoke(func(i int) {
+			assert.Equal(t, 1, i)
+		}), "invoke failed")
+		assert.False(t, called, "decorator of a descendant must not be called")
+
+		require.NoError(t, grandchild.Invoke(func(i int) {
+			assert.Equal(t, 11, i)
+		}), "invoke failed")
+		assert.True(t, called, "decorator must be called")
+	})
+
+	t.Run("values of descendants cannot be decorated", func(t *testing.T) {
+		type T struct{}
+
+		c := New()
+		child := c.Child("child")
+		require.NoError(t, child.Provide(func() *T { return &T{} }), "provide failed")
+
+		err := c.Decorate(func(t *T) *T { return t })
+		require.Error(t, err, "decorate must fail")
+		assert.Contains(t, err.Error(),
+			"cannot decorate *dig.T: it was not provided to the container or its ancestors")
+
+		require.NoError(t, child.Invoke(func(*T) {}), "invoke failed")
+	})
+
+	t.Run("invoke errors name the child", func(t *testing.T) {
+		c := New()
+		child := c.Child("api")
+
+		require.NoError(t, child.Provide(func() *bytes.Buffer {
+			panic("this function must not be called")
+		}), "provide failed")
+
+		err := c.Invoke(func(*bytes.Buffer) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assert.NotContains(t, err.Error(), "child container")
+
+		err = child.Invoke(func(*bytes.Buffer, io.Reader) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`cannot invoke function in child container "root/api":`,
+			`missing dependencies for function "go.uber.org/dig".TestChildren\S+`,
+			`type io.Reader is not in the container`,
+		)
+
+		err = child.Invoke(func() error { return errors.New("great sadness") })
+		require.Error(t, err, "invoke must fail")
+		assert.Equal(t, "great sadness", err.Error(), "errors returned by the function must not be wrapped")
+	})
+
+	t.Run("export has no effect on the root", func(t *testing.T) {
+		c := New()
+
+		require.NoError(t, c.Provide(func() *bytes.Buffer {
+			return new(bytes.Buffer)
+		}, Export(true)), "provide failed")
+		require.NoError(t, c.Invoke(func(b *bytes.Buffer) {
+			assert.NotNil(t, b)
+		}), "invoke failed")
+	})
+
+	t.Run("children and paths", func(t *testing.T) {
+		root := New()
+		api := root.Child("api")
+		v1 := api.Child("v1")
+		v2 := api.Child("v2")
+		worker := root.Child("worker")
+
+		assert.Equal(t, []*Container{api, worker}, root.Children())
+		assert.Equal(t, []*Container{v1, v2}, api.Children())
+		assert.Empty(t, v1.Children())
+
+		assert.Equal(t, "root", root.Path())
+		assert.Equal(t, "root/api", api.Path())
+		assert.Equal(t, "root/api/v2", v2.Path())
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		root := New()
+		api := root.Child("api")
+		v1 := api.Child("v1")
+		api.Child("v1") // shadowed by the first child with this name
+
+		tests := []struct {
+			desc string
+			from *Container
+			path string
+			want *Container
+		}{
+			{desc: "empty path", from: api, path: "", want: api},
+			{desc: "single name", from: root, path: "api", want: api},
+			{desc: "nested", from: root, path: "api/v1", want: v1},
+			{desc: "relative", from: api, path: "v1", want: v1},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.desc, func(t *testing.T) {
+				got, ok := tt.from.Lookup(tt.path)
+				require.True(t, ok, "lookup failed")
+				assert.True(t, tt.want == got, "unexpected container %q", got.Path())
+			})
+		}
+
+		for _, path := range []string{"v1", "api/v2", "api//v1", "api/v1/", "root/api"} {
+			_, ok := root.Lookup(path)
+			assert.False(t, ok, "lookup of %q should fail", path)
+		}
+	})
+
+	t.Run("errors name the container of the constructor", func(t *testing.T) {
+		root := New()
+		v1 := root.Child("api").Child("v1")
+
+		require.NoError(t, v1.Provide(func() (*bytes.Buffer, error) {
+			return nil, errors.New("great sadness")
+		}), "provide failed")
+		err := v1.Invoke(func(*bytes.Buffer) {})
+		require.Error(t, err, "invoke should fail")
+		assertErrorMatches(t, err,
+			`cannot invoke function in child container "root/api/v1":`,
+			`could not build arguments for function "go.uber.org/dig".TestChildren\S+`,
+			`failed to build \*bytes.Buffer:`,
+			`function "go.uber.org/dig".TestChildren\S+ \(\S+\) in container "root/api/v1" returned a non-nil error:`,
+			`great sadness`,
+		)
+
+		err = v1.Provide(func() *bytes.Buffer { return nil })
+		require.Error(t, err, "provide should fail")
+		assertErrorMatches(t, err,
+			`function "go.uber.org/dig".TestChildren\S+ \(\S+\) in container "root/api/v1" cannot be provided:`,
+			`cannot provide \*bytes.Buffer from \[0\]:`,
+			`already provided by "go.uber.org/dig".TestChildren\S+ \(\S+\) in container "root/api/v1"`,
+		)
+	})
+
+	t.Run("detach releases values and runs cleanups", func(t *testing.T) {
+		root := New()
+		req := root.Child("request")
+		sub := req.Child("sub")
+
+		var calls []string
+		req.OnDetach(func() { calls = append(calls, "req 1") })
+		req.OnDetach(func() { calls = append(calls, "req 2") })
+		sub.OnDetach(func() { calls = append(calls, "sub") })
+		root.OnDetach(func() { calls = append(calls, "root") })
+
+		require.NoError(t, req.Provide(func() *bytes.Buffer {
+			return new(bytes.Buffer)
+		}), "provide failed")
+		require.NoError(t, req.Invoke(func(*bytes.Buffer) {}), "invoke failed")
+
+		require.NoError(t, req.Detach(), "detach failed")
+		assert.Equal(t, []string{"sub", "req 2", "req 1"}, calls)
+		assert.Empty(t, root.Children())
+		assert.Empty(t, req.values, "values must be released")
+
+		require.NoError(t, req.Detach(), "detaching twice must be a no-op")
+		assert.Len(t, calls, 3, "cleanups must run once")
+
+		for _, c := range []*Container{req, sub, req.Child("late")} {
+			err := c.Invoke(func() {})
+			require.Error(t, err, "invoke on a detached container must fail")
+			assert.Contains(t, err.Error(), "was detached")
+
+			err = c.Provide(func() *bytes.Buffer { return nil })
+			require.Error(t, err, "provide on a detached container must fail")
+			assert.Contains(t, err.Error(), "was detached")
+		}
+	})
+
+	t.Run("detach removes exported constructors", func(t *testing.T) {
+		root := New()
+		child := root.Child("child")
+
+		require.NoError(t, child.Provide(func() *bytes.Buffer {
+			return new(bytes.Buffer)
+		}, Export(true)), "provide failed")
+		require.NoError(t, child.Detach(), "detach failed")
+
+		err := root.Invoke(func(*bytes.Buffer) {})
+		require.Error(t, err, "exported type must not be reachable")
+		assertErrorMatches(t, err, `type \*bytes.Buffer is not in the container`)
+
+		require.NoError(t, root.Provide(func() *bytes.Buffer {
+			return new(bytes.Buffer)
+		}), "the parent may provide the type again")
+	})
+
+	t.Run("detach fails if exported values were built", func(t *testing.T) {
+		root := New()
+		child := root.Child("child")
+
+		require.NoError(t, child.Provide(func() *bytes.Buffer {
+			return new(bytes.Buffer)
+		}, Export(true)), "provide failed")
+		require.NoError(t, root.Invoke(func(*bytes.Buffer) {}), "invoke failed")
+
+		err := child.Detach()
+		require.Error(t, err, "detach must fail")
+		assertErrorMatches(t, err,
+			`cannot detach child container "root/child": values exported by "go.uber.org/dig".TestChildren\S+ \(\S+\) were already built`,
+		)
+		assert.Equal(t, []*Container{child}, root.Children())
+		require.NoError(t, root.Invoke(func(*bytes.Buffer) {}), "invoke failed")
+	})
+
+	t.Run("detach a root container", func(t *testing.T) {
+		err := New().Detach()
+		require.Error(t, err, "detach must fail")
+		assert.Contains(t, err.Error(), "cannot detach a root container")
+	})
 }
 
 func TestGroups(t *testing.T) {
@@ -1029,8 +1427,10 @@ func testSubGraphs(t *testing.T, tf func(*testing.T, newContainerFunc)) {
 			parent := New(oo...)
 			child := parent.Child("child")
 			return containerView{
-				Provide: child.Provide,
-				Invoke:  parent.Invoke,
+				Provide: func(f interface{}, opts ...ProvideOption) error {
+					return child.Provide(f, append(opts, Export(true))...)
+				},
+				Invoke: parent.Invoke,
 			}
 		})
 	})
@@ -1240,145 +1640,1096 @@ func testGroups(t *testing.T, newContainer newContainerFunc) {
 	t.Run("provide multiple values", func(t *testing.T) {
 		c := newContainer(setRand(rand.New(rand.NewSource(0))))
 
-		type outInt struct {
+		type outInt struct {
+			Out
+			Int int `group:"foo"`
+		}
+
+		provideInt := func(i int) {
+			require.NoError(t, c.Provide(func() (outInt, error) {
+				return outInt{Int: i}, nil
+			}), "failed to provide int")
+		}
+
+		type outString struct {
+			Out
+			String string `group:"foo"`
+		}
+
+		provideString := func(s string) {
+			require.NoError(t, c.Provide(func() outString {
+				return outString{String: s}
+			}), "failed to provide string")
+		}
+
+		type outBoth struct {
+			Out
+
+			Int    int    `group:"foo"`
+			String string `group:"foo"`
+		}
+
+		provideBoth := func(i int, s string) {
+			require.NoError(t, c.Provide(func() (outBoth, error) {
+				return outBoth{Int: i, String: s}, nil
+			}), "failed to provide both")
+		}
+
+		provideInt(1)
+		provideString("foo")
+		provideBoth(2, "bar")
+		provideString("baz")
+		provideInt(3)
+		provideBoth(4, "qux")
+		provideBoth(5, "quux")
+		provideInt(6)
+		provideInt(7)
+
+		type in struct {
+			In
+
+			Ints    []int    `group:"foo"`
+			Strings []string `group:"foo"`
+		}
+
+		require.NoError(t, c.Invoke(func(got in) {
+			assert.Equal(t, in{
+				Ints:    []int{5, 3, 4, 1, 6, 7, 2},
+				Strings: []string{"foo", "bar", "baz", "quux", "qux"},
+			}, got)
+		}), "failed to invoke")
+	})
+
+	t.Run("duplicate values are supported", func(t *testing.T) {
+		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+
+		type out struct {
+			Out
+
+			Result string `group:"s"`
+		}
+
+		provide := func(i string) {
+			require.NoError(t, c.Provide(func() out {
+				return out{Result: i}
+			}), "failed to provide")
+		}
+
+		provide("a")
+		provide("b")
+		provide("c")
+		provide("a")
+		provide("d")
+		provide("d")
+		provide("a")
+		provide("e")
+
+		type stringSlice []string
+
+		type in struct {
+			In
+
+			Strings stringSlice `group:"s"`
+		}
+
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Equal(t,
+				stringSlice{"d", "c", "a", "a", "d", "e", "b", "a"},
+				i.Strings)
+		}), "failed to invoke")
+	})
+
+	t.Run("failure to build a grouped value fails everything", func(t *testing.T) {
+		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+
+		type out struct {
+			Out
+
+			Result string `group:"x"`
+		}
+
+		require.NoError(t, c.Provide(func() (out, error) {
+			return out{Result: "foo"}, nil
+		}), "failed to provide")
+
+		var gaveErr error
+		require.NoError(t, c.Provide(func() (out, error) {
+			gaveErr = errors.New("great sadness")
+			return out{}, gaveErr
+		}), "failed to provide")
+
+		require.NoError(t, c.Provide(func() out {
+			return out{Result: "bar"}
+		}), "failed to provide")
+
+		type in struct {
+			In
+
+			Strings []string `group:"x"`
+		}
+
+		err := c.Invoke(func(i in) {
+			require.FailNow(t, "this function must not be called")
+		})
+		require.Error(t, err, "expected failure")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".testGroups`,
+			`could not build value group string\[group="x"\]:`,
+			`function "go.uber.org/dig".testGroups\S+ \(\S+:\d+\)( in container "\S+")? returned a non-nil error:`,
+			"great sadness",
+		)
+		assert.Equal(t, gaveErr, RootCause(err))
+	})
+
+	t.Run("flatten collects slices", func(t *testing.T) {
+		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+
+		type out struct {
+			Out
+
+			Value []int `group:"val,flatten"`
+		}
+
+		provide := func(i []int) {
+			require.NoError(t, c.Provide(func() out {
+				return out{Value: i}
+			}), "failed to provide ")
+		}
+
+		provide([]int{1, 2})
+		provide([]int{3})
+		provide([]int{})
+
+		type in struct {
+			In
+
+			Values []int `group:"val"`
+		}
+
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Equal(t, []int{2, 3, 1}, i.Values)
+		}), "invoke failed")
+	})
+
+	t.Run("flatten via option", func(t *testing.T) {
+		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+
+		require.NoError(t, c.Provide(func() []int {
+			return []int{1, 2, 3}
+		}, Group("val,flatten")), "failed to provide")
+
+		require.NoError(t, c.Provide(func() int {
+			return 4
+		}, Group("val")), "failed to provide")
+
+		type in struct {
+			In
+
+			Values []int `group:"val"`
+		}
+
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Equal(t, []int{2, 3, 4, 1}, i.Values)
+		}), "invoke failed")
+	})
+
+	t.Run("flatten via option error if not a slice", func(t *testing.T) {
+		c := newContainer()
+
+		err := c.Provide(func() int { return 1 }, Group("val,flatten"))
+		require.Error(t, err, "failed to provide")
+		assertErrorMatches(t, err,
+			`function "go.uber.org/dig".testGroups\S+ \(\S+:\d+\)( in container "\S+")? cannot be provided:`,
+			"flatten can be applied to slices only: int is not a slice",
+		)
+	})
+
+	t.Run("invalid group option", func(t *testing.T) {
+		c := newContainer()
+
+		err := c.Provide(func() int { return 1 }, Group("val,flattened"))
+		require.Error(t, err, "failed to provide")
+		assert.Contains(t, err.Error(), `cannot parse group "val,flattened": invalid option "flattened"`)
+	})
+
+	t.Run("keyed values are consumed as a map", func(t *testing.T) {
+		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+
+		type out struct {
+			Out
+
+			JSON string `group:"codecs,key=json"`
+			YAML string `group:"codecs,key=yaml"`
+		}
+
+		require.NoError(t, c.Provide(func() out {
+			return out{JSON: "json codec", YAML: "yaml codec"}
+		}), "failed to provide")
+
+		require.NoError(t, c.Provide(func() string {
+			return "proto codec"
+		}, Group("codecs,key=proto")), "failed to provide")
+
+		require.NoError(t, c.Provide(func() string {
+			return "unkeyed codec"
+		}, Group("codecs")), "failed to provide")
+
+		type in struct {
+			In
+
+			Codecs map[string]string `group:"codecs"`
+			All    []string          `group:"codecs"`
+		}
+
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Equal(t, map[string]string{
+				"json":  "json codec",
+				"yaml":  "yaml codec",
+				"proto": "proto codec",
+			}, i.Codecs)
+			assert.Len(t, i.All, 4)
+			assert.Contains(t, i.All, "unkeyed codec")
+		}), "invoke failed")
+	})
+
+	t.Run("empty map received without provides", func(t *testing.T) {
+		c := newContainer()
+
+		type in struct {
+			In
+
+			Codecs map[string]string `group:"codecs"`
+		}
+
+		require.NoError(t, c.Invoke(func(i in) {
+			require.NotNil(t, i.Codecs)
+			assert.Empty(t, i.Codecs)
+		}), "invoke failed")
+	})
+
+	t.Run("duplicate keys in the same constructor fail", func(t *testing.T) {
+		c := newContainer()
+
+		type out struct {
+			Out
+
+			A string `group:"codecs,key=json"`
+			B string `group:"codecs,key=json"`
+		}
+
+		err := c.Provide(func() out { return out{} })
+		require.Error(t, err, "provide must fail")
+		assertErrorMatches(t, err,
+			`function "go.uber.org/dig".testGroups\S+ \(\S+:\d+\)( in container "\S+")? cannot be provided:`,
+			`cannot provide string\[group="codecs"\] with key "json" from \[0\].B:`,
+			`already provided by \[0\].A`,
+		)
+	})
+
+	t.Run("duplicate keys across constructors fail", func(t *testing.T) {
+		c := newContainer()
+
+		require.NoError(t, c.Provide(func() string {
+			return "json codec"
+		}, Group("codecs,key=json")), "failed to provide")
+
+		err := c.Provide(func() string {
+			return "another json codec"
+		}, Group("codecs,key=json"))
+		require.Error(t, err, "provide must fail")
+		assertErrorMatches(t, err,
+			`function "go.uber.org/dig".testGroups\S+ \(\S+:\d+\)( in container "\S+")? cannot be provided:`,
+			`cannot provide string\[group="codecs"\] with key "json" from \[0\]:`,
+			`already provided by "go.uber.org/dig".testGroups\S+`,
+		)
+	})
+
+	t.Run("key cannot be used with flatten", func(t *testing.T) {
+		c := newContainer()
+
+		err := c.Provide(func() []string { return nil }, Group("codecs,flatten,key=json"))
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(),
+			`cannot use key with flatten: each element of []string would use the same key "json"`)
+	})
+
+	t.Run("soft value groups receive only built values", func(t *testing.T) {
+		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+
+		type out struct {
+			Out
+
+			Value string `group:"plugins"`
+		}
+
+		var calls []string
+		provide := func(s string) {
+			require.NoError(t, c.Provide(func() out {
+				calls = append(calls, s)
+				return out{Value: s}
+			}), "failed to provide")
+		}
+
+		type usesA struct{}
+		require.NoError(t, c.Provide(func() (usesA, out) {
+			calls = append(calls, "a")
+			return usesA{}, out{Value: "a"}
+		}), "failed to provide")
+		provide("b")
+		provide("c")
+
+		type softIn struct {
+			In
+
+			Plugins []string `group:"plugins,soft"`
+		}
+
+		require.NoError(t, c.Invoke(func(i softIn) {
+			assert.Empty(t, i.Plugins)
+		}), "invoke failed")
+		assert.Empty(t, calls, "soft value group must not call constructors")
+
+		require.NoError(t, c.Invoke(func(usesA, softIn) {}), "invoke failed")
+		require.NoError(t, c.Invoke(func(i softIn) {
+			assert.Equal(t, []string{"a"}, i.Plugins)
+		}), "invoke failed")
+		assert.Equal(t, []string{"a"}, calls)
+
+		type in struct {
+			In
+
+			Plugins []string `group:"plugins"`
+		}
+
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Len(t, i.Plugins, 3)
+		}), "invoke failed")
+		require.NoError(t, c.Invoke(func(i softIn) {
+			assert.Len(t, i.Plugins, 3)
+		}), "invoke failed")
+	})
+
+	t.Run("soft value groups don't introduce cycles", func(t *testing.T) {
+		c := New()
+
+		type registry struct{ plugins []string }
+		type softIn struct {
+			In
+
+			Plugins []string `group:"plugins,soft"`
+		}
+		type in struct {
+			In
+
+			Plugins []string `group:"plugins"`
+		}
+
+		// The registry soft-consumes plugins which depend on it.
+		require.NoError(t, c.Provide(func(i softIn) *registry {
+			return &registry{plugins: i.Plugins}
+		}), "failed to provide")
+		require.NoError(t, c.Provide(func(r *registry) string {
+			return fmt.Sprintf("plugin of %d", len(r.plugins))
+		}, Group("plugins")), "failed to provide")
+
+		require.NoError(t, c.Invoke(func(r *registry, i in) {
+			assert.Empty(t, r.plugins)
+			assert.Equal(t, []string{"plugin of 0"}, i.Plugins)
+		}), "invoke failed")
+
+		var b bytes.Buffer
+		require.NoError(t, Visualize(c, &b), "visualize failed")
+		assert.NotContains(t, b.String(), `-> "[type=string group=plugins]"`,
+			"soft value groups must not be drawn as dependencies")
+	})
+
+	t.Run("soft value groups receive decorated values", func(t *testing.T) {
+		c := New()
+
+		type softIn struct {
+			In
+
+			Plugins []string `group:"plugins,soft"`
+		}
+		type in struct {
+			In
+
+			Plugins []string `group:"plugins"`
+		}
+
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("plugins")), "failed to provide")
+		require.NoError(t, c.Decorate(strings.ToUpper, Group("plugins")), "failed to decorate")
+
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Equal(t, []string{"A"}, i.Plugins)
+		}), "invoke failed")
+		require.NoError(t, c.Invoke(func(i softIn) {
+			assert.Equal(t, []string{"A"}, i.Plugins)
+		}), "invoke failed")
+	})
+
+	t.Run("As with value groups", func(t *testing.T) {
+		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+
+		bufs := []*bytes.Buffer{
+			bytes.NewBufferString("foo"),
+			bytes.NewBufferString("bar"),
+		}
+		for _, b := range bufs {
+			b := b
+			require.NoError(t, c.Provide(func() *bytes.Buffer {
+				return b
+			}, Group("buffers"), As(new(io.Reader), new(io.Writer))), "failed to provide")
+		}
+
+		type in struct {
+			In
+
+			Buffers []*bytes.Buffer `group:"buffers"`
+			Readers []io.Reader     `group:"buffers"`
+			Writers []io.Writer     `group:"buffers"`
+		}
+
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Len(t, i.Buffers, 2)
+			assert.Len(t, i.Readers, 2)
+			assert.Len(t, i.Writers, 2)
+			for _, b := range bufs {
+				assert.Contains(t, i.Buffers, b)
+				assert.Contains(t, i.Readers, b)
+				assert.Contains(t, i.Writers, b)
+			}
+		}), "invoke failed")
+	})
+
+	t.Run("As with flattened and keyed value groups", func(t *testing.T) {
+		c := newContainer()
+
+		require.NoError(t, c.Provide(func() []*bytes.Buffer {
+			return []*bytes.Buffer{new(bytes.Buffer), new(bytes.Buffer)}
+		}, Group("buffers,flatten"), As(new(io.Reader))), "failed to provide")
+
+		require.NoError(t, c.Provide(func() *bytes.Buffer {
+			return bytes.NewBufferString("stdin")
+		}, Group("readers,key=stdin"), As(new(io.Reader))), "failed to provide")
+
+		type in struct {
+			In
+
+			Buffers []io.Reader          `group:"buffers"`
+			Readers map[string]io.Reader `group:"readers"`
+		}
+
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Len(t, i.Buffers, 2)
+			require.Contains(t, i.Readers, "stdin")
+			assert.Equal(t, "stdin", i.Readers["stdin"].(*bytes.Buffer).String())
+		}), "invoke failed")
+
+		err := c.Provide(func() *strings.Reader {
+			return strings.NewReader("stdin")
+		}, Group("readers,key=stdin"), As(new(io.Reader)))
+		require.Error(t, err, "provide must fail")
+		assertErrorMatches(t, err,
+			`cannot provide io.Reader\[group="readers"\] with key "stdin" from \[0\]:`,
+			`already provided by "go.uber.org/dig".testGroups\S+`,
+		)
+	})
+
+	t.Run("As with value groups must be implemented", func(t *testing.T) {
+		c := newContainer()
+
+		err := c.Provide(func() *bytes.Buffer {
+			panic("this function must not be called")
+		}, Group("buffers"), As(new(io.Closer)))
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(), "invalid dig.As: *bytes.Buffer does not implement io.Closer")
+	})
+
+	t.Run("soft cannot be used for results", func(t *testing.T) {
+		c := newContainer()
+
+		err := c.Provide(func() string { return "" }, Group("plugins,soft"))
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(),
+			`cannot use soft with result value groups: soft was used with group "plugins"`)
+	})
+
+	t.Run("min and max bound the number of values", func(t *testing.T) {
+		c := newContainer()
+
+		type in struct {
+			In
+
+			Handlers []string `group:"handlers,min=1,max=2"`
+		}
+
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("handlers")), "failed to provide")
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.Equal(t, []string{"a"}, i.Handlers)
+		}), "invoke failed")
+	})
+
+	t.Run("min fails without providers", func(t *testing.T) {
+		c := newContainer()
+
+		type in struct {
+			In
+
+			Handlers []string `group:"handlers,min=1"`
+		}
+
+		err := c.Invoke(func(i in) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`missing dependencies for function "go.uber.org/dig".testGroups\S+`,
+			`value group string\[group="handlers"\] must have at least 1 values: got 0`,
+		)
+		assert.True(t, IsGroupCardinality(err), "expected a cardinality error")
+		assert.True(t, CanVisualizeError(err), "error must be visualizable")
+	})
+
+	t.Run("min fails with too few values", func(t *testing.T) {
+		c := newContainer()
+
+		type in struct {
+			In
+
+			Handlers []string `group:"handlers,min=3"`
+		}
+
+		require.NoError(t, c.Provide(func() []string {
+			return []string{"a", "b"}
+		}, Group("handlers,flatten")), "failed to provide")
+
+		err := c.Invoke(func(i in) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".testGroups\S+`,
+			`value group string\[group="handlers"\] must have at least 3 values: got 2`,
+		)
+		assert.True(t, IsGroupCardinality(err), "expected a cardinality error")
+	})
+
+	t.Run("max fails with too many values", func(t *testing.T) {
+		c := newContainer()
+
+		type in struct {
+			In
+
+			Handlers map[string]string `group:"handlers,max=1"`
+		}
+
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("handlers,key=a")), "failed to provide")
+		require.NoError(t, c.Provide(func() string { return "b" }, Group("handlers,key=b")), "failed to provide")
+
+		err := c.Invoke(func(i in) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".testGroups\S+`,
+			`value group string\[group="handlers"\] must have at most 1 values: got 2`,
+		)
+		assert.True(t, IsGroupCardinality(err), "expected a cardinality error")
+	})
+
+	t.Run("cardinality errors of dependencies", func(t *testing.T) {
+		c := newContainer()
+
+		type server struct{}
+		type in struct {
+			In
+
+			Handlers []string `group:"handlers,max=1"`
+		}
+
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("handlers")), "failed to provide")
+		require.NoError(t, c.Provide(func() string { return "b" }, Group("handlers")), "failed to provide")
+		require.NoError(t, c.Provide(func(in) *server { return &server{} }), "failed to provide")
+
+		err := c.Invoke(func(*server) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".testGroups\S+`,
+			`failed to build \*dig.server:`,
+			`value group string\[group="handlers"\] must have at most 1 values: got 2`,
+		)
+		assert.True(t, IsGroupCardinality(err), "expected a cardinality error")
+		assert.False(t, IsGroupCardinality(errors.New("great sadness")), "unexpected cardinality error")
+	})
+
+	t.Run("min and max cannot be used for results", func(t *testing.T) {
+		c := newContainer()
+
+		err := c.Provide(func() string { return "" }, Group("handlers,min=1"))
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(),
+			`cannot use min or max with result value groups: min or max was used with group "handlers"`)
+	})
+}
+
+func TestDecorate(t *testing.T) {
+	t.Run("named values", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() string { return "primary" }, Name("primary")), "provide failed")
+		require.NoError(t, c.Provide(func() string { return "secondary" }, Name("secondary")), "provide failed")
+
+		require.NoError(t, c.Decorate(func(s string) string {
+			return s + "!"
+		}, Name("primary")), "decorate failed")
+
+		type params struct {
+			In
+
+			Primary   string `name:"primary"`
+			Secondary string `name:"secondary"`
+		}
+		require.NoError(t, c.Invoke(func(p params) {
+			assert.Equal(t, "primary!", p.Primary)
+			assert.Equal(t, "secondary", p.Secondary)
+		}), "invoke failed")
+	})
+
+	t.Run("named values with result objects", func(t *testing.T) {
+		type in struct {
+			In
+
+			S string `name:"primary"`
+		}
+		type out struct {
+			Out
+
+			S string `name:"primary"`
+		}
+
+		c := New()
+		require.NoError(t, c.Provide(func() string { return "primary" }, Name("primary")), "provide failed")
+		require.NoError(t, c.Decorate(func(p in) out {
+			return out{S: p.S + "!"}
+		}), "decorate failed")
+		require.NoError(t, c.Invoke(func(p in) {
+			assert.Equal(t, "primary!", p.S)
+		}), "invoke failed")
+	})
+
+	t.Run("values provided with dig.As", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *bytes.Buffer {
+			return bytes.NewBufferString("hello")
+		}, As(new(io.Reader))), "provide failed")
+		require.NoError(t, c.Decorate(func(r io.Reader) io.Reader {
+			return io.MultiReader(r, strings.NewReader(" world"))
+		}), "decorate failed")
+
+		require.NoError(t, c.Invoke(func(r io.Reader, b *bytes.Buffer) {
+			_, ok := r.(*bytes.Buffer)
+			assert.False(t, ok, "reader must be decorated")
+			got, err := ioutil.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "hello world", string(got))
+		}), "invoke failed")
+	})
+
+	t.Run("decorate with dig.As", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *bytes.Buffer {
+			return bytes.NewBufferString("original")
+		}, As(new(io.Reader))), "provide failed")
+		require.NoError(t, c.Decorate(func(*bytes.Buffer) *bytes.Buffer {
+			return bytes.NewBufferString("decorated")
+		}, As(new(io.Reader))), "decorate failed")
+
+		require.NoError(t, c.Invoke(func(r io.Reader, b *bytes.Buffer) {
+			assert.True(t, r == io.Reader(b), "reader must be replaced with the decorated buffer")
+			assert.Equal(t, "decorated", b.String())
+		}), "invoke failed")
+	})
+
+	t.Run("chains", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() string { return "v" }), "provide failed")
+
+		decorate := func(c *Container, suffix string, opts ...ProvideOption) {
+			require.NoError(t, c.Decorate(func(s string) string {
+				return s + suffix
+			}, opts...), "decorate failed")
+		}
+		decorate(c, "a")
+		decorate(c, "b")
+		decorate(c, "c", Priority(1))
+		decorate(c, "d", Priority(-1))
+
+		child := c.Child("child")
+		decorate(child, "e", Priority(2))
+
+		require.NoError(t, child.Invoke(func(s string) {
+			assert.Equal(t, "vcabde", s)
+		}), "invoke failed")
+		require.NoError(t, c.Invoke(func(s string) {
+			assert.Equal(t, "vcabd", s)
+		}), "invoke failed")
+
+		chain := child.DecoratorChain(reflect.TypeOf(""))
+		require.Len(t, chain, 5)
+		for i, want := range []DecoratorInfo{
+			{ID: 4, Container: "root", Priority: 1},
+			{ID: 2, Container: "root"},
+			{ID: 3, Container: "root"},
+			{ID: 5, Container: "root", Priority: -1},
+			{ID: 6, Container: "root/child", Priority: 2},
+		} {
+			assert.Regexp(t, `^"go.uber.org/dig".TestDecorate\S+ \(\S+:\d+\)$`, chain[i].Function)
+			chain[i].Function = ""
+			assert.Equal(t, want, chain[i], "decorator %d", i)
+		}
+		assert.Len(t, c.DecoratorChain(reflect.TypeOf("")), 4)
+		assert.Empty(t, c.DecoratorChain(reflect.TypeOf(""), Name("other")))
+	})
+
+	t.Run("priority with constructors", func(t *testing.T) {
+		err := New().Provide(func() string { return "" }, Priority(1))
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(), "cannot use dig.Priority with constructors")
+	})
+
+	t.Run("invalid decorators", func(t *testing.T) {
+		type out struct {
 			Out
-			Int int `group:"foo"`
-		}
 
-		provideInt := func(i int) {
-			require.NoError(t, c.Provide(func() (outInt, error) {
-				return outInt{Int: i}, nil
-			}), "failed to provide int")
+			S string `group:"strings"`
 		}
 
-		type outString struct {
-			Out
-			String string `group:"foo"`
+		c := New()
+		require.NoError(t, c.Provide(func() string { return "" }), "provide failed")
+
+		tests := []struct {
+			desc string
+			dtor interface{}
+			opts []ProvideOption
+			err  string
+		}{
+			{
+				desc: "missing parameter",
+				dtor: func() string { return "" },
+				err:  "cannot decorate string: decorators must accept the values they decorate as parameters",
+			},
+			{
+				desc: "not provided",
+				dtor: func(i int) int { return i },
+				err:  "cannot decorate int: it was not provided to the container or its ancestors",
+			},
+			{
+				desc: "named value not provided",
+				dtor: func(s string) string { return s },
+				opts: []ProvideOption{Name("missing")},
+				err:  `cannot decorate string[name="missing"]: it was not provided`,
+			},
+			{
+				desc: "value group result",
+				dtor: func(s string) out { return out{S: s} },
+				err:  `cannot decorate string[group="strings"]: use dig.Group to decorate the values of a value group`,
+			},
+			{
+				desc: "no results",
+				dtor: func(s string) error { return nil },
+				err:  "must decorate at least one non-error type",
+			},
 		}
 
-		provideString := func(s string) {
-			require.NoError(t, c.Provide(func() outString {
-				return outString{String: s}
-			}), "failed to provide string")
+		for _, tt := range tests {
+			t.Run(tt.desc, func(t *testing.T) {
+				err := c.Decorate(tt.dtor, tt.opts...)
+				require.Error(t, err, "decorate must fail")
+				assert.Contains(t, err.Error(), tt.err)
+			})
 		}
+	})
+}
 
-		type outBoth struct {
-			Out
+func TestDecorateGroupElements(t *testing.T) {
+	t.Run("chains", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
 
-			Int    int    `group:"foo"`
-			String string `group:"foo"`
+		decorate := func(c *Container, suffix string, opts ...ProvideOption) {
+			require.NoError(t, c.Decorate(func(s string) string {
+				return s + suffix
+			}, append(opts, Group("values"))...), "failed to decorate")
 		}
+		decorate(child, "c", Priority(1))
+		decorate(c, "a")
+		decorate(c, "b", Priority(1))
 
-		provideBoth := func(i int, s string) {
-			require.NoError(t, c.Provide(func() (outBoth, error) {
-				return outBoth{Int: i, String: s}, nil
-			}), "failed to provide both")
-		}
+		require.NoError(t, child.Provide(func() string { return "v" }, Group("values")), "failed to provide")
+		require.NoError(t, child.Invoke(func(p struct {
+			In
 
-		provideInt(1)
-		provideString("foo")
-		provideBoth(2, "bar")
-		provideString("baz")
-		provideInt(3)
-		provideBoth(4, "qux")
-		provideBoth(5, "quux")
-		provideInt(6)
-		provideInt(7)
+			Values []string `group:"values"`
+		}) {
+			assert.Equal(t, []string{"vbac"}, p.Values)
+		}), "invoke failed")
+
+		chain := child.DecoratorChain(reflect.TypeOf(""), Group("values"))
+		require.Len(t, chain, 3)
+		assert.Equal(t, []string{"root", "root", "root/child"},
+			[]string{chain[0].Container, chain[1].Container, chain[2].Container})
+		assert.Equal(t, 1, chain[0].Priority)
+	})
 
+	t.Run("values provided to the parent", func(t *testing.T) {
 		type in struct {
 			In
 
-			Ints    []int    `group:"foo"`
-			Strings []string `group:"foo"`
+			Values []string          `group:"values"`
+			Keyed  map[string]string `group:"values"`
 		}
 
-		require.NoError(t, c.Invoke(func(got in) {
-			assert.Equal(t, in{
-				Ints:    []int{5, 3, 4, 1, 6, 7, 2},
-				Strings: []string{"foo", "bar", "baz", "quux", "qux"},
-			}, got)
-		}), "failed to invoke")
-	})
-
-	t.Run("duplicate values are supported", func(t *testing.T) {
-		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+		c := New()
+		child := c.Child("child")
 
-		type out struct {
-			Out
+		var calls int
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("values")), "failed to provide")
+		require.NoError(t, c.Provide(func() string { return "b" }, Group("values,key=b")), "failed to provide")
+		require.NoError(t, child.Decorate(func(s string) string {
+			calls++
+			return s + "c"
+		}, Group("values")), "failed to decorate")
 
-			Result string `group:"s"`
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.ElementsMatch(t, []string{"a", "b"}, i.Values)
+			assert.Equal(t, map[string]string{"b": "b"}, i.Keyed)
+		}), "invoke failed")
+		for i := 0; i < 2; i++ {
+			require.NoError(t, child.Invoke(func(i in) {
+				assert.ElementsMatch(t, []string{"ac", "bc"}, i.Values)
+				assert.Equal(t, map[string]string{"b": "bc"}, i.Keyed)
+			}), "invoke failed")
 		}
+		assert.Equal(t, 2, calls, "each value must be decorated once")
+	})
 
-		provide := func(i string) {
-			require.NoError(t, c.Provide(func() out {
-				return out{Result: i}
-			}), "failed to provide")
+	t.Run("registered after the group was consumed", func(t *testing.T) {
+		type in struct {
+			In
+
+			Values []string `group:"values"`
 		}
 
-		provide("a")
-		provide("b")
-		provide("c")
-		provide("a")
-		provide("d")
-		provide("d")
-		provide("a")
-		provide("e")
+		c := New()
+		child := c.Child("child")
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("values")), "failed to provide")
+		require.NoError(t, child.Decorate(func(s string) string { return s + "b" }, Group("values")),
+			"failed to decorate")
+		require.NoError(t, child.Invoke(func(i in) {
+			assert.Equal(t, []string{"ab"}, i.Values)
+		}), "invoke failed")
 
-		type stringSlice []string
+		require.NoError(t, c.Decorate(func(s string) string { return s + "c" }, Group("values")),
+			"failed to decorate")
+		require.NoError(t, child.Invoke(func(i in) {
+			assert.Equal(t, []string{"acb"}, i.Values)
+		}), "invoke failed")
+	})
+
+	t.Run("decorates each value", func(t *testing.T) {
+		c := New()
 
 		type in struct {
 			In
 
-			Strings stringSlice `group:"s"`
+			Values []string `group:"values"`
 		}
 
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("values")), "failed to provide")
+		require.NoError(t, c.Provide(func() []string {
+			return []string{"b", "c"}
+		}, Group("values,flatten")), "failed to provide")
+		require.NoError(t, c.Provide(func() int { return 1 }), "failed to provide")
+
+		require.NoError(t, c.Decorate(func(s string, i int) string {
+			return fmt.Sprintf("%v%d", s, i)
+		}, Group("values")), "failed to decorate")
+		require.NoError(t, c.Decorate(func(s string) string {
+			return "+" + s
+		}, Group("values")), "failed to decorate")
+
 		require.NoError(t, c.Invoke(func(i in) {
-			assert.Equal(t,
-				stringSlice{"d", "c", "a", "a", "d", "e", "b", "a"},
-				i.Strings)
-		}), "failed to invoke")
+			assert.ElementsMatch(t, []string{"+a1", "+b1", "+c1"}, i.Values)
+		}), "invoke failed")
 	})
 
-	t.Run("failure to build a grouped value fails everything", func(t *testing.T) {
-		c := newContainer(setRand(rand.New(rand.NewSource(0))))
+	t.Run("flattened decorators filter values", func(t *testing.T) {
+		c := New()
 
-		type out struct {
-			Out
+		type in struct {
+			In
 
-			Result string `group:"x"`
+			Values []string          `group:"values"`
+			Keyed  map[string]string `group:"values"`
 		}
 
-		require.NoError(t, c.Provide(func() (out, error) {
-			return out{Result: "foo"}, nil
-		}), "failed to provide")
+		require.NoError(t, c.Provide(func() []string {
+			return []string{"a", "", "b"}
+		}, Group("values,flatten")), "failed to provide")
+		require.NoError(t, c.Provide(func() string { return "" }, Group("values,key=empty")), "failed to provide")
+		require.NoError(t, c.Provide(func() string { return "c" }, Group("values,key=c")), "failed to provide")
 
-		var gaveErr error
-		require.NoError(t, c.Provide(func() (out, error) {
-			gaveErr = errors.New("great sadness")
-			return out{}, gaveErr
-		}), "failed to provide")
+		require.NoError(t, c.Decorate(func(s string) []string {
+			if s == "" {
+				return nil
+			}
+			return []string{s}
+		}, Group("values,flatten")), "failed to decorate")
 
-		require.NoError(t, c.Provide(func() out {
-			return out{Result: "bar"}
-		}), "failed to provide")
+		require.NoError(t, c.Invoke(func(i in) {
+			assert.ElementsMatch(t, []string{"a", "b", "c"}, i.Values)
+			assert.Equal(t, map[string]string{"c": "c"}, i.Keyed)
+		}), "invoke failed")
+	})
 
-		type in struct {
+	t.Run("keyed values cannot be replaced by many values", func(t *testing.T) {
+		c := New()
+
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("values,key=a")), "failed to provide")
+		require.NoError(t, c.Decorate(func(s string) []string {
+			return []string{s, s}
+		}, Group("values,flatten")), "failed to decorate")
+
+		err := c.Invoke(func(in struct {
 			In
 
-			Strings []string `group:"x"`
-		}
+			Values map[string]string `group:"values"`
+		}) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assert.Contains(t, err.Error(),
+			`cannot decorate string[group="values"] with key "a": decorators returned 2 values for a single key`)
+	})
 
-		err := c.Invoke(func(i in) {
-			require.FailNow(t, "this function must not be called")
+	t.Run("decorator errors", func(t *testing.T) {
+		c := New()
+
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("values")), "failed to provide")
+		require.NoError(t, c.Decorate(func(s string) (string, error) {
+			return "", errors.New("great sadness")
+		}, Group("values")), "failed to decorate")
+
+		err := c.Invoke(func(in struct {
+			In
+
+			Values []string `group:"values"`
+		}) {
+			t.Fatal("this function must not be called")
 		})
-		require.Error(t, err, "expected failure")
+		require.Error(t, err, "invoke must fail")
 		assertErrorMatches(t, err,
-			`could not build arguments for function "go.uber.org/dig".testGroups`,
-			`could not build value group string\[group="x"\]:`,
-			`function "go.uber.org/dig".testGroups\S+ \(\S+:\d+\) returned a non-nil error:`,
+			`could not build arguments for function "go.uber.org/dig".TestDecorateGroupElements\S+`,
+			`could not build value group string\[group="values"\]:`,
+			`function "go.uber.org/dig".TestDecorateGroupElements\S+ \(\S+\) returned a non-nil error:`,
 			"great sadness",
 		)
-		assert.Equal(t, gaveErr, RootCause(err))
+		assert.Equal(t, "great sadness", RootCause(err).Error())
+	})
+
+	t.Run("decorators which depend on their value group", func(t *testing.T) {
+		type registry struct{}
+		type in struct {
+			In
+
+			Values []string `group:"values"`
+		}
+
+		t.Run("directly", func(t *testing.T) {
+			c := New()
+			require.NoError(t, c.Provide(func() string { return "a" }, Group("values")), "failed to provide")
+
+			err := c.Decorate(func(s string, i in) string { return s }, Group("values"))
+			require.Error(t, err, "decorate must fail")
+			assert.True(t, IsCycleDetected(err), "expected a cycle error")
+			assertErrorMatches(t, err,
+				`this function introduces a cycle:`,
+				`string\[group="values"\] provided by "go.uber.org/dig".TestDecorateGroupElements\S+ \(\S+\)`,
+				`depends on string\[group="values"\] provided by "go.uber.org/dig".TestDecorateGroupElements\S+ \(\S+\)`,
+			)
+		})
+
+		t.Run("through a constructor provided before", func(t *testing.T) {
+			c := New()
+			require.NoError(t, c.Provide(func(in) *registry { return &registry{} }), "failed to provide")
+
+			err := c.Decorate(func(s string, _ *registry) string { return s }, Group("values"))
+			require.Error(t, err, "decorate must fail")
+			assert.True(t, IsCycleDetected(err), "expected a cycle error")
+		})
+
+		t.Run("through a constructor provided after", func(t *testing.T) {
+			c := New()
+			require.NoError(t, c.Provide(func() string { return "a" }, Group("values")), "failed to provide")
+			require.NoError(t, c.Decorate(func(s string, _ *registry) string { return s }, Group("values")),
+				"failed to decorate")
+
+			err := c.Provide(func(in) *registry { return &registry{} })
+			require.Error(t, err, "provide must fail")
+			assert.True(t, IsCycleDetected(err), "expected a cycle error")
+		})
+	})
+
+	t.Run("invalid decorators", func(t *testing.T) {
+		tests := []struct {
+			desc    string
+			dtor    interface{}
+			group   string
+			wantErr string
+		}{
+			{
+				desc:    "no parameters",
+				dtor:    func() string { return "" },
+				group:   "values",
+				wantErr: "element decorators must accept the decorated value as their first parameter",
+			},
+			{
+				desc:    "no results",
+				dtor:    func(string) {},
+				group:   "values",
+				wantErr: "element decorators must return the decorated value, and optionally an error",
+			},
+			{
+				desc:    "different result",
+				dtor:    func(string) int { return 0 },
+				group:   "values",
+				wantErr: "element decorators must return string to decorate string: got int",
+			},
+			{
+				desc:    "flatten without a slice",
+				dtor:    func(s string) string { return s },
+				group:   "values,flatten",
+				wantErr: "element decorators must return []string to decorate string: got string",
+			},
+			{
+				desc:  "key",
+				dtor:  func(s string) string { return s },
+				group: "values,key=foo",
+				wantErr: "cannot use options other than flatten with element decorators: " +
+					`group "values,key=foo" was requested`,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.desc, func(t *testing.T) {
+				c := New()
+				err := c.Decorate(tt.dtor, Group(tt.group))
+				require.Error(t, err, "decorate must fail")
+				assert.Contains(t, err.Error(), tt.wantErr)
+			})
+		}
 	})
 }
 
@@ -1678,16 +3029,6 @@ func TestProvideIncompatibleOptions(t *testing.T) {
 		assert.Contains(t, err.Error(), "cannot use named values with value groups: "+
 			"name:\"bar\" provided with group:\"foo\"")
 	})
-
-	t.Run("group and As", func(t *testing.T) {
-		c := New()
-		err := c.Provide(func() *bytes.Buffer {
-			panic("this function must not be called")
-		}, Group("foo"), As(new(io.Reader)))
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "cannot use dig.As with value groups: "+
-			`dig.As provided with group:"foo"`)
-	})
 }
 
 func TestCantProvideUntypedNil(t *testing.T) {
@@ -2242,7 +3583,7 @@ func TestProvideFailures(t *testing.T) {
 		})
 		require.Error(t, err, "expected error on the second provide")
 		assertErrorMatches(t, err,
-			`function "go.uber.org/dig".TestProvideFailures\S+ \(\S+:\d+\) cannot be provided:`,
+			`function "go.uber.org/dig".TestProvideFailures\S+ \(\S+:\d+\) in container "root/1/2" cannot be provided:`,
 			`cannot provide \*dig.A\[name="foo"\] from \[0\].A:`,
 			`already provided by "go.uber.org/dig".TestProvideFailures\S+`,
 		)
@@ -2975,6 +4316,140 @@ func TestFailingFunctionDoesNotCreateInvalidState(t *testing.T) {
 	}), "second invoke must fail")
 }
 
+func TestRecoverFromPanics(t *testing.T) {
+	type type1 struct{}
+	type type2 struct{}
+
+	assertPanicked := func(t *testing.T, err error, msg string, msgs ...string) {
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err, msg, msgs...)
+
+		p, ok := RootCause(err).(PanicError)
+		require.True(t, ok, "root cause must be a PanicError: got %T", RootCause(err))
+		assert.Equal(t, "great sadness", p.Value)
+		assert.Contains(t, string(p.Stack), "TestRecoverFromPanics")
+	}
+
+	t.Run("constructor", func(t *testing.T) {
+		c := New(RecoverFromPanics())
+		require.NoError(t, c.Provide(func() *type1 { panic("great sadness") }), "provide failed")
+
+		err := c.Invoke(func(*type1) {
+			t.Fatal("this function must not be called")
+		})
+		assertPanicked(t, err,
+			`could not build arguments for function "go.uber.org/dig".TestRecoverFromPanics\S+`,
+			`failed to build \*dig.type1:`,
+			`function "go.uber.org/dig".TestRecoverFromPanics\S+ \(\S+\) panicked: great sadness`,
+		)
+		assert.True(t, CanVisualizeError(err), "error must be visualizable")
+	})
+
+	t.Run("decorator in a child", func(t *testing.T) {
+		c := New(RecoverFromPanics())
+		child := c.Child("child")
+		require.NoError(t, c.Provide(func() *type1 { return &type1{} }), "provide failed")
+		require.NoError(t, child.Decorate(func(*type1) *type1 { panic("great sadness") }), "decorate failed")
+
+		assertPanicked(t, child.Invoke(func(*type1) {}),
+			`cannot invoke function in child container "root/child":`,
+			`failed to build \*dig.type1:`,
+			`function "go.uber.org/dig".TestRecoverFromPanics\S+ \(\S+\) in container "root/child" panicked: great sadness`,
+		)
+	})
+
+	t.Run("element decorator", func(t *testing.T) {
+		c := New(RecoverFromPanics())
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("values")), "provide failed")
+		require.NoError(t, c.Decorate(func(string) string { panic("great sadness") }, Group("values")),
+			"decorate failed")
+
+		assertPanicked(t, c.Invoke(func(struct {
+			In
+
+			Values []string `group:"values"`
+		}) {
+		}),
+			`could not build value group string\[group="values"\]:`,
+			`function "go.uber.org/dig".TestRecoverFromPanics\S+ \(\S+\) panicked: great sadness`,
+		)
+	})
+
+	t.Run("invoked function", func(t *testing.T) {
+		c := New(RecoverFromPanics())
+
+		assertPanicked(t, c.Invoke(func() { panic("great sadness") }),
+			`function "go.uber.org/dig".TestRecoverFromPanics\S+ \(\S+\) panicked: great sadness`,
+		)
+	})
+
+	t.Run("request scope", func(t *testing.T) {
+		scopes := New(RecoverFromPanics()).RequestScopes()
+		require.NoError(t, scopes.Provide(func() *type2 { panic("great sadness") }), "provide failed")
+		s, err := scopes.New()
+		require.NoError(t, err, "new failed")
+
+		assertPanicked(t, s.Invoke(func(*type2) {}),
+			`failed to build \*dig.type2:`,
+			`function "go.uber.org/dig".TestRecoverFromPanics\S+ \(\S+\) panicked: great sadness`,
+		)
+		assertPanicked(t, s.Invoke(func() { panic("great sadness") }),
+			`function "go.uber.org/dig".TestRecoverFromPanics\S+ \(\S+\) panicked: great sadness`,
+		)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *type1 { panic("great sadness") }), "provide failed")
+
+		assert.PanicsWithValue(t, "great sadness", func() {
+			c.Invoke(func(*type1) {})
+		})
+	})
+}
+
+func TestCallSite(t *testing.T) {
+	t.Run("errors name the call site", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(time.Now), "provide failed")
+
+		err := c.Provide(time.Now)
+		require.Error(t, err, "provide must fail")
+		assertErrorMatches(t, err,
+			`function "time".Now \(\S+, registered at \S+/dig_test.go:\d+\) cannot be provided:`,
+			`already provided by "time".Now \(\S+, registered at \S+/dig_test.go:\d+\)`,
+		)
+	})
+
+	t.Run("caller skip", func(t *testing.T) {
+		c := New()
+		provide := func(ctor interface{}) error {
+			return c.Provide(ctor, CallerSkip(1))
+		}
+		require.NoError(t, provide(time.Now), "provide failed")
+
+		_, file, line, _ := runtime.Caller(0)
+		err := provide(time.Now)
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(), fmt.Sprintf("registered at %v:%d) cannot be provided", file, line+1))
+	})
+
+	t.Run("decorators", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() string { return " foo " }), "provide failed")
+		require.NoError(t, c.Decorate(strings.TrimSpace), "decorate failed")
+		require.NoError(t, c.Decorate(strings.ToUpper, Group("names")), "decorate failed")
+
+		chain := c.DecoratorChain(reflect.TypeOf(""))
+		require.Len(t, chain, 1)
+		assert.Regexp(t, `^"strings".TrimSpace \(\S+, registered at \S+/dig_test.go:\d+\)$`, chain[0].Function)
+
+		chain = c.DecoratorChain(reflect.TypeOf(""), Group("names"))
+		require.Len(t, chain, 1)
+		assert.Regexp(t, `^"strings".ToUpper \(\S+, registered at \S+/dig_test.go:\d+\)$`, chain[0].Function)
+	})
+}
+
 func BenchmarkProvideCycleDetection(b *testing.B) {
 	// func TestBenchmarkProvideCycleDetection(b *testing.T) {
 	type A struct{}
@@ -331,4 +331,91 @@
 //
 // Note that values in a value group are unordered. Dig makes no guarantees
 // about the order in which these values will be produced.
+//
+// Value Groups: Flatten
+//
+// A constructor that produces several values for the same group may return
+// them as a slice tagged with the `flatten` option. Each element of the slice
+// is added to the group individually, as if it had been produced by a
+// separate constructor.
+//
+//   type HandlersResult struct {
+//     dig.Out
+//
+//     Handlers []Handler `group:"server,flatten"`
+//   }
+//
+//   func NewDebugHandlers() HandlersResult {
+//     return HandlersResult{
+//       Handlers: []Handler{newPprofHandler(), newHealthHandler()},
+//     }
+//   }
+//
+// The flatten option may also be passed to the dig.Group option.
+//
+//   c.Provide(newDebugHandlers, dig.Group("server,flatten"))
+//
+// Consumers of the group are unaffected: NewServer above receives the
+// pprof and health handlers alongside all other handlers in the "server"
+// group. Flatten cannot be used when consuming a value group.
+//
+// Value Groups: Keys
+//
+// Values may be added to a value group under a key with the `key=..` option.
+//
+//   type CodecResult struct {
+//     dig.Out
+//
+//     Codec Codec `group:"codecs,key=json"`
+//   }
+//
+// Constructors can then request the keyed values of the group as a map with
+// string keys tagged with `group:".."`.
+//
+//   type RegistryParams struct {
+//     dig.In
+//
+//     Codecs map[string]Codec `group:"codecs"`
+//   }
+//
+// Values added to the group without a key are not included in the map, but
+// keyed values are included when the group is requested as a slice. Only one
+// value may be added to a group under a given key; providing a constructor
+// which adds a value under a key that is already in use fails.
+//
+// Value Groups: Soft
+//
+// Requesting a value group calls every constructor that provides a value to
+// that group. A consumer which does not need every value of the group to be
+// built on its behalf may request it with the `soft` option.
+//
+//   type PluginParams struct {
+//     dig.In
+//
+//     Plugins []Plugin `group:"plugins,soft"`
+//   }
+//
+// A soft value group receives only the values of those constructors which
+// were already called because something else depended on them. Constructors
+// of optional plugins are therefore only called if the plugins are requested
+// elsewhere. The soft option cannot be used when providing values to a value
+// group.
+//
+// Value Groups: Cardinality
+//
+// A value group is delivered as an empty slice if nothing was provided to it.
+// Consumers which require values in the group may bound their number with the
+// `min=N` and `max=N` options.
+//
+//   type ServerParams struct {
+//     dig.In
+//
+//     Handlers []Handler `group:"server,min=1"`
+//   }
+//
+// The container fails to call a function whose group has no constructors
+// that could satisfy the minimum, and fails to build a group which ends up
+// with too few or too many values. Such failures are highlighted in the
+// output of Visualize when used with VisualizeError. The min and max options
+// cannot be used when providing values to a value group.
 package dig // import "go.uber.org/dig"
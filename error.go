@@ -84,56 +84,131 @@ func (e wrappedError) Error() string {
 	return fmt.Sprintf("%v: %v", e.msg, e.err)
 }
 
+// inContainer describes the child container with the given path for error
+// messages. Functions provided to root containers have an empty path and are
+// not described.
+func inContainer(path string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" in container %q", path)
+}
+
 // errProvide is returned when a constructor could not be Provided into the
 // container.
 type errProvide struct {
 	Func   *digreflect.Func
+	Path   string // path of the child container, if any
 	Reason error
 }
 
 func (e errProvide) cause() error { return e.Reason }
 
 func (e errProvide) Error() string {
-	return fmt.Sprintf("function %v cannot be provided: %v", e.Func, e.Reason)
+	return fmt.Sprintf("function %v%v cannot be provided: %v", e.Func, inContainer(e.Path), e.Reason)
 }
 
 // errConstructorFailed is returned when a user-provided constructor failed
 // with a non-nil error.
 type errConstructorFailed struct {
 	Func   *digreflect.Func
+	Path   string // path of the child container, if any
 	Reason error
 }
 
 func (e errConstructorFailed) cause() error { return e.Reason }
 
 func (e errConstructorFailed) Error() string {
-	return fmt.Sprintf("function %v returned a non-nil error: %v", e.Func, e.Reason)
+	return fmt.Sprintf("function %v%v returned a non-nil error: %v", e.Func, inContainer(e.Path), e.Reason)
+}
+
+// PanicError is the root cause of the errors returned when a constructor, a
+// decorator or an invoked function panics in a container created with the
+// RecoverFromPanics option.
+type PanicError struct {
+	// Value passed to panic.
+	Value interface{}
+
+	// Stack trace of the goroutine which panicked, as formatted by
+	// runtime/debug.Stack.
+	Stack []byte
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprint(e.Value)
+}
+
+// errPanicked is returned when a user-provided function panicked and the
+// panic was recovered.
+type errPanicked struct {
+	Func   *digreflect.Func
+	Path   string // path of the child container, if any
+	Reason PanicError
+}
+
+func (e errPanicked) cause() error { return e.Reason }
+
+func (e errPanicked) Error() string {
+	return fmt.Sprintf("function %v%v panicked: %v", e.Func, inContainer(e.Path), e.Reason)
+}
+
+// errCallFailed returns the error describing the failure of a call to the
+// function at the given location: either it panicked, it timed out, or it
+// returned err.
+func errCallFailed(f *digreflect.Func, path string, err error) error {
+	switch err := err.(type) {
+	case PanicError:
+		return errPanicked{Func: f, Path: path, Reason: err}
+	case errTimedOut:
+		return err
+	}
+	return errConstructorFailed{Func: f, Path: path, Reason: err}
+}
+
+// errRetriesExhausted is returned when a constructor with a retry policy
+// failed on every attempt, or with an error which may not be retried.
+type errRetriesExhausted struct {
+	CtorID   dot.CtorID
+	Attempts int
+	Reason   error
+}
+
+func (e errRetriesExhausted) cause() error { return e.Reason }
+
+func (e errRetriesExhausted) Error() string {
+	return fmt.Sprintf("failed after %d attempts: %v", e.Attempts, e.Reason)
+}
+
+func (e errRetriesExhausted) updateGraph(g *dot.Graph) {
+	g.SetAttempts(e.CtorID, e.Attempts)
 }
 
 // errArgumentsFailed is returned when a function could not be run because one
 // of its dependencies failed to build for any reason.
 type errArgumentsFailed struct {
 	Func   *digreflect.Func
+	Path   string // path of the child container, if any
 	Reason error
 }
 
 func (e errArgumentsFailed) cause() error { return e.Reason }
 
 func (e errArgumentsFailed) Error() string {
-	return fmt.Sprintf("could not build arguments for function %v: %v", e.Func, e.Reason)
+	return fmt.Sprintf("could not build arguments for function %v%v: %v", e.Func, inContainer(e.Path), e.Reason)
 }
 
 // errMissingDependencies is returned when the dependencies of a function are
 // not available in the container.
 type errMissingDependencies struct {
 	Func   *digreflect.Func
+	Path   string // path of the child container, if any
 	Reason error
 }
 
 func (e errMissingDependencies) cause() error { return e.Reason }
 
 func (e errMissingDependencies) Error() string {
-	return fmt.Sprintf("missing dependencies for function %v: %v", e.Func, e.Reason)
+	return fmt.Sprintf("missing dependencies for function %v%v: %v", e.Func, inContainer(e.Path), e.Reason)
 }
 
 // errParamSingleFailed is returned when a paramSingle could not be built.
@@ -178,6 +253,34 @@ func (e errParamGroupFailed) updateGraph(g *dot.Graph) {
 	g.FailGroupNodes(e.Key.group, e.Key.t, e.CtorID)
 }
 
+// errGroupCardinality is returned when the number of values in a value group
+// is outside of the bounds requested with the min and max options.
+type errGroupCardinality struct {
+	Key   key
+	Min   int
+	Max   int // zero if unbounded
+	Count int
+}
+
+func (e errGroupCardinality) Error() string {
+	if e.Count < e.Min {
+		return fmt.Sprintf("value group %v must have at least %d values: got %d", e.Key, e.Min, e.Count)
+	}
+	return fmt.Sprintf("value group %v must have at most %d values: got %d", e.Key, e.Max, e.Count)
+}
+
+func (e errGroupCardinality) updateGraph(g *dot.Graph) {
+	g.FailGroup(e.Key.group, e.Key.t)
+}
+
+// IsGroupCardinality reports whether the given error, returned by Invoke, was
+// caused by a value group with fewer or more values than requested with the
+// min and max options.
+func IsGroupCardinality(err error) bool {
+	_, ok := RootCause(err).(errGroupCardinality)
+	return ok
+}
+
 // errMissingType is returned when a single value that was expected in the
 // container was not available.
 type errMissingType struct {
@@ -25,6 +25,7 @@ import (
 	"strconv"
 	"text/template"
 
+	"go.uber.org/dig/internal/digreflect"
 	"go.uber.org/dig/internal/dot"
 )
 
@@ -102,7 +103,7 @@ var _graphTmpl = template.Must(
 	{{end -}}
 	{{range $index, $ctor := .Ctors}}
 		subgraph cluster_{{$index}} {
-			constructor_{{$index}} [shape=plaintext label={{quote .Name}}];
+			constructor_{{$index}} [shape=plaintext label={{quote .Label}}];
 			{{with .ErrorType}}color={{.Color}};{{end}}
 			{{range .Results}}
 				{{- quote .String}} [{{.Attributes}}];
@@ -115,6 +116,10 @@ var _graphTmpl = template.Must(
 			constructor_{{$index}} -> {{quote .String}} [ltail=cluster_{{$index}}];
 		{{end -}}
 	{{end}}
+	{{range .Decorators}}
+		{{- .ID}} [shape=box style=dashed label={{quote .Label}}];
+		{{.ID}} -> {{quote .Receives}};
+	{{end -}}
 	{{range .Failed.TransitiveFailures}}
 		{{- quote .String}} [color=orange];
 	{{end -}}
@@ -161,19 +166,113 @@ func CanVisualizeError(err error) bool {
 func (c *Container) createGraph() *dot.Graph {
 	dg := dot.NewGraph()
 
-	for _, n := range c.nodes {
-		dg.AddCtor(newDotCtor(n), n.paramList.DotParam(), n.resultList.DotResult())
+	for _, n := range c.visibleNodes() {
+		// Values overridden by a provider nearer to c are marked as
+		// shadowed, both where they are produced and where they are
+		// consumed by constructors which don't see the override.
+		params := n.paramList.DotParam()
+		for _, p := range params {
+			k := key{name: p.Name, t: p.Type}
+			if p.Group == "" && n.providedTo.getContainer(k) != c.getContainer(k) {
+				p.Shadowed = true
+			}
+		}
+		results := n.resultList.DotResult()
+		for _, r := range results {
+			k := key{name: r.Name, t: r.Type}
+			if r.Group == "" && c.getContainer(k) != n.container {
+				r.Shadowed = true
+			}
+		}
+		dg.AddCtor(newDotCtor(n), params, results)
+	}
+
+	for _, k := range c.decoratedKeys() {
+		var chain []*dot.Decorator
+		for _, n := range c.getDecorators(k) {
+			callFile, callLine := callSiteOf(n.location)
+			chain = append(chain, &dot.Decorator{
+				Name:     n.location.Name,
+				Package:  n.location.Package,
+				File:     n.location.File,
+				Line:     n.location.Line,
+				CallFile: callFile,
+				CallLine: callLine,
+				Value:    &dot.Node{Type: k.t, Name: k.name},
+			})
+		}
+		dg.AddDecorators(chain)
 	}
 
 	return dg
 }
 
+// decoratedKeys returns the keys of the values decorated by this container or
+// its ancestors, ordered by their string representation.
+func (c *Container) decoratedKeys() []key {
+	keys := make(map[key]bool)
+	for p := c; p != nil; p = p.parent {
+		for k, ds := range p.decorators {
+			if len(ds) > 0 {
+				keys[k] = true
+			}
+		}
+	}
+	return sortedKeys(keys)
+}
+
+// visibleNodes returns the nodes registered with this container and its
+// ancestors, starting with the root, in the order in which they were
+// provided.
+func (c *Container) visibleNodes() []*node {
+	var nodes []*node
+	if c.parent != nil {
+		nodes = c.parent.visibleNodes()
+	}
+
+	for _, n := range c.nodes {
+		if n.container == c {
+			nodes = append(nodes, n)
+		}
+	}
+	for _, cc := range c.children {
+		for _, n := range cc.nodes {
+			if n.container == c {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return nodes
+}
+
+// getContainer returns the nearest container, starting with this one, which
+// has providers for the given key.
+func (c *Container) getContainer(k key) *Container {
+	for p := c; p != nil; p = p.parent {
+		if len(p.providers[k]) > 0 {
+			return p
+		}
+	}
+	return nil
+}
+
 func newDotCtor(n *node) *dot.Ctor {
+	callFile, callLine := callSiteOf(n.location)
 	return &dot.Ctor{
-		ID:      n.id,
-		Name:    n.location.Name,
-		Package: n.location.Package,
-		File:    n.location.File,
-		Line:    n.location.Line,
+		ID:       n.ID(),
+		Name:     n.location.Name,
+		Package:  n.location.Package,
+		File:     n.location.File,
+		Line:     n.location.Line,
+		CallFile: callFile,
+		CallLine: callLine,
+	}
+}
+
+// callSiteOf returns the file and line of the call site of f, if known.
+func callSiteOf(f *digreflect.Func) (file string, line int) {
+	if f.CallSite == nil {
+		return "", 0
 	}
+	return f.CallSite.File, f.CallSite.Line
 }
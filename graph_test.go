@@ -22,6 +22,7 @@ package dig
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
@@ -301,6 +302,60 @@ func TestDotGraph(t *testing.T) {
 		assertCtorsEqual(t, expected, dg.Ctors)
 	})
 
+	t.Run("flattened value groups", func(t *testing.T) {
+		type in struct {
+			In
+
+			D []t1 `group:"foo"`
+		}
+
+		type out1 struct {
+			Out
+
+			A []t1 `group:"foo,flatten"`
+		}
+
+		type out2 struct {
+			Out
+
+			A t1 `group:"foo"`
+		}
+
+		res0 := tresult(type1, "", "foo", 0)
+		res1 := tresult(type1, "", "foo", 1)
+
+		expected := []*dot.Ctor{
+			{
+				Params:  []*dot.Param{p2},
+				Results: []*dot.Result{res0},
+			},
+			{
+				Params:  []*dot.Param{p4},
+				Results: []*dot.Result{res1},
+			},
+			{
+				GroupParams: []*dot.Group{
+					{
+						Type:    type1,
+						Name:    "foo",
+						Results: []*dot.Result{res0, res1},
+					},
+				},
+				Results: []*dot.Result{r3},
+			},
+		}
+
+		c := New()
+		c.Provide(func(B t2) out1 { return out1{} })
+		c.Provide(func(B t4) out2 { return out2{} })
+		c.Provide(func(i in) t3 { return t3{} })
+
+		dg := c.createGraph()
+		assertCtorsEqual(t, expected, dg.Ctors)
+		require.Len(t, dg.Groups, 1)
+		assert.Equal(t, []*dot.Result{res0, res1}, dg.Groups[0].Results)
+	})
+
 	t.Run("named values", func(t *testing.T) {
 		type in struct {
 			In
@@ -376,7 +431,7 @@ func TestNewDotCtor(t *testing.T) {
 	type t1 struct{}
 	type t2 struct{}
 
-	n, err := newNode(func(A t1) t2 { return t2{} }, nodeOptions{})
+	n, err := newNode(func(A t1) t2 { return t2{} }, nodeOptions{ID: 42})
 	require.NoError(t, err)
 
 	n.location = &digreflect.Func{
@@ -387,13 +442,54 @@ func TestNewDotCtor(t *testing.T) {
 	}
 
 	ctor := newDotCtor(n)
-	assert.Equal(t, n.id, ctor.ID)
+	assert.Equal(t, dot.CtorID(42), ctor.ID)
 	assert.Equal(t, "function1", ctor.Name)
 	assert.Equal(t, "pkg1", ctor.Package)
 	assert.Equal(t, "file1", ctor.File)
 	assert.Equal(t, 24534, ctor.Line)
 }
 
+func TestVisualizeRepeatedConstructors(t *testing.T) {
+	type t1 struct{}
+
+	c := New()
+	child := c.Child("child")
+	for _, name := range []string{"fail", "ok"} {
+		fail := name == "fail"
+		require.NoError(t, c.Provide(func() (t1, error) {
+			if fail {
+				return t1{}, errors.New("great sadness")
+			}
+			return t1{}, nil
+		}, Name(name)))
+	}
+	ctor := func() t1 { return t1{} }
+	require.NoError(t, c.Provide(ctor, Name("again")))
+	require.NoError(t, child.Provide(ctor, Name("again"), Override(true)))
+
+	dg := child.createGraph()
+	require.Len(t, dg.Ctors, 4, "every provided function must be a separate node")
+	ids := make(map[dot.CtorID]struct{})
+	for _, ctor := range dg.Ctors {
+		ids[ctor.ID] = struct{}{}
+	}
+	assert.Len(t, ids, 4, "every provided function must have its own ID")
+
+	err := c.Invoke(func(struct {
+		In
+
+		T1 t1 `name:"fail"`
+	}) {
+	})
+	require.Error(t, err, "invoke must fail")
+
+	dg = c.createGraph()
+	require.NoError(t, updateGraph(dg, err))
+	require.Len(t, dg.Ctors, 1, "only the failed constructor must remain")
+	require.Len(t, dg.Ctors[0].Results, 1)
+	assert.Equal(t, "fail", dg.Ctors[0].Results[0].Name)
+}
+
 func TestVisualize(t *testing.T) {
 	type t1 struct{}
 	type t2 struct{}
@@ -580,6 +676,84 @@ func TestVisualize(t *testing.T) {
 
 		VerifyVisualization(t, "missingDep", c, VisualizeError(err))
 	})
+
+	t.Run("dig.As with value groups", func(t *testing.T) {
+		c := New()
+
+		type in struct {
+			In
+
+			Readers []io.Reader `group:"foo"`
+		}
+
+		require.NoError(t, c.Provide(
+			func() *bytes.Buffer {
+				panic("this function should not be called")
+			},
+			Group("foo"),
+			As(new(io.Reader)),
+		))
+		require.NoError(t, c.Provide(func(in) t1 { return t1{} }))
+
+		VerifyVisualization(t, "dig_as_grouped", c)
+	})
+
+	t.Run("group cardinality", func(t *testing.T) {
+		c := New()
+
+		type in struct {
+			In
+
+			Foo []t1 `group:"foo,max=1"`
+		}
+
+		require.NoError(t, c.Provide(func() t1 { return t1{} }, Group("foo")))
+		require.NoError(t, c.Provide(func() t1 { return t1{} }, Group("foo")))
+		require.NoError(t, c.Provide(func(in) t2 { return t2{} }))
+		err := c.Invoke(func(t2) {})
+		require.Error(t, err)
+
+		VerifyVisualization(t, "group_cardinality", c, VisualizeError(err))
+	})
+
+	t.Run("child overrides", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+
+		require.NoError(t, c.Provide(func() t1 { return t1{} }))
+		require.NoError(t, c.Provide(func(t1) t2 { return t2{} }))
+		require.NoError(t, child.Provide(func() t1 { return t1{} }, Override(true)))
+		require.NoError(t, child.Provide(func(t2) t3 { return t3{} }))
+
+		VerifyVisualization(t, "child_overrides", child)
+	})
+
+	t.Run("decorators", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+
+		require.NoError(t, c.Provide(func() t1 { return t1{} }))
+		require.NoError(t, c.Provide(func(t1) t2 { return t2{} }))
+		require.NoError(t, c.Decorate(func(t1) t1 { return t1{} }))
+		require.NoError(t, c.Decorate(func(t1) t1 { return t1{} }, Priority(1)))
+		require.NoError(t, child.Decorate(func(t2) t2 { return t2{} }))
+
+		VerifyVisualization(t, "decorators", child)
+	})
+
+	t.Run("call sites", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(strings.NewReader))
+		require.NoError(t, c.Provide(func() string { return "" }))
+		require.NoError(t, c.Decorate(strings.TrimSpace))
+
+		var b bytes.Buffer
+		require.NoError(t, Visualize(c, &b))
+		assert.Regexp(t, `constructor_\d+ \[shape=plaintext label="NewReader\\nregistered at graph_test.go:\d+"\]`, b.String())
+		assert.Regexp(t, `label="TrimSpace \(1\)\\nregistered at graph_test.go:\d+"`, b.String())
+		assert.NotRegexp(t, `label="TestVisualize[^"]*registered at`, b.String(),
+			"call sites in the same file as the function must be omitted")
+	})
 }
 
 type visualizableErr struct{}
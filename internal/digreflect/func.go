@@ -41,10 +41,19 @@ type Func struct {
 
 	// Line number in the file at which this function is defined.
 	Line int
+
+	// Location of the call which registered this function, if known. For
+	// call sites, this is the calling function and the location of the call.
+	CallSite *Func
 }
 
-// String returns a string representation of the function.
+// String returns a string representation of the function. The call site is
+// included if it's in a different file than the function.
 func (f *Func) String() string {
+	if cs := f.CallSite; cs != nil && cs.File != f.File {
+		// "path/to/package".MyFunction (path/to/file.go:42, registered at path/to/main.go:12)
+		return fmt.Sprintf("%q.%v (%v:%v, registered at %v:%v)", f.Package, f.Name, f.File, f.Line, cs.File, cs.Line)
+	}
 	// "path/to/package".MyFunction (path/to/file.go:42)
 	return fmt.Sprintf("%q.%v (%v:%v)", f.Package, f.Name, f.File, f.Line)
 }
@@ -64,6 +73,27 @@ func InspectFunc(function interface{}) *Func {
 	}
 }
 
+// Caller returns information about the function calling the caller of
+// Caller, and the location of that call. The argument skip is the number of
+// additional stack frames to ascend. It returns nil if that information is
+// not available.
+func Caller(skip int) *Func {
+	pc, file, line, ok := runtime.Caller(skip + 2)
+	if !ok {
+		return nil
+	}
+	var pkgName, funcName string
+	if f := runtime.FuncForPC(pc); f != nil {
+		pkgName, funcName = splitFuncName(f.Name())
+	}
+	return &Func{
+		Name:    funcName,
+		Package: pkgName,
+		File:    file,
+		Line:    line,
+	}
+}
+
 const _vendor = "/vendor/"
 
 func splitFuncName(function string) (pname string, fname string) {
@@ -133,3 +133,28 @@ func TestSplitFuncEmptyString(t *testing.T) {
 	assert.Empty(t, pname, "package name must be empty")
 	assert.Empty(t, fname, "function name must be empty")
 }
+
+func callerOfCaller(skip int) *Func { return Caller(skip) }
+
+func TestCaller(t *testing.T) {
+	f := callerOfCaller(0)
+	assert.Equal(t, "go.uber.org/dig/internal/digreflect", f.Package)
+	assert.Equal(t, "TestCaller", f.Name)
+	assert.True(t, strings.HasSuffix(f.File, "func_test.go"), "unexpected file %q", f.File)
+
+	assert.Equal(t, "TestCaller.func1", func() *Func { return callerOfCaller(0) }().Name)
+	assert.Equal(t, "TestCaller", func() *Func { return callerOfCaller(1) }().Name)
+	assert.Nil(t, callerOfCaller(1000), "must be nil past the top of the stack")
+}
+
+func TestFuncStringWithCallSite(t *testing.T) {
+	f := &Func{Name: "NewFoo", Package: "foo", File: "foo/foo.go", Line: 42}
+	assert.Equal(t, `"foo".NewFoo (foo/foo.go:42)`, f.String())
+
+	f.CallSite = &Func{Name: "main", Package: "main", File: "foo/foo.go", Line: 12}
+	assert.Equal(t, `"foo".NewFoo (foo/foo.go:42)`, f.String(),
+		"call sites in the same file must be omitted")
+
+	f.CallSite.File = "main.go"
+	assert.Equal(t, `"foo".NewFoo (foo/foo.go:42, registered at main.go:12)`, f.String())
+}
@@ -22,6 +22,7 @@ package dot
 
 import (
 	"fmt"
+	"path/filepath"
 	"reflect"
 )
 
@@ -34,7 +35,8 @@ const (
 	transitiveFailure
 )
 
-// CtorID is a unique numeric identifier for constructors.
+// CtorID is a unique numeric identifier for constructors. Constructors
+// provided several times have a different ID each time.
 type CtorID uintptr
 
 // Ctor encodes a constructor provided to the container for the DOT graph.
@@ -43,6 +45,9 @@ type Ctor struct {
 	Package     string
 	File        string
 	Line        int
+	CallFile    string // file of the call which registered the constructor
+	CallLine    int
+	Attempts    int // number of calls of a constructor which was retried
 	ID          CtorID
 	Params      []*Param
 	GroupParams []*Group
@@ -50,6 +55,25 @@ type Ctor struct {
 	ErrorType   ErrorType
 }
 
+// Label returns the label of the constructor node.
+func (c *Ctor) Label() string {
+	label := c.Name + registeredAt(c.File, c.CallFile, c.CallLine)
+	if c.Attempts > 1 {
+		label += fmt.Sprintf("\nfailed after %d attempts", c.Attempts)
+	}
+	return label
+}
+
+// registeredAt describes the call site of a function defined in the given
+// file, on a separate line. The call site is omitted if it's unknown or in
+// the same file as the function.
+func registeredAt(file, callFile string, callLine int) string {
+	if len(callFile) == 0 || callFile == file {
+		return ""
+	}
+	return fmt.Sprintf("\nregistered at %v:%d", filepath.Base(callFile), callLine)
+}
+
 // removeParam deletes the dependency on the provided result's nodeKey.
 // This is used to prune links to results of deleted constructors.
 func (c *Ctor) removeParam(k nodeKey) {
@@ -63,9 +87,10 @@ func (c *Ctor) removeParam(k nodeKey) {
 }
 
 type nodeKey struct {
-	t     reflect.Type
-	name  string
-	group string
+	t        reflect.Type
+	name     string
+	group    string
+	shadowed bool
 }
 
 // Node is a single node in a graph and is embedded into Params and Results.
@@ -73,10 +98,15 @@ type Node struct {
 	Type  reflect.Type
 	Name  string
 	Group string
+
+	// Shadowed is set for values which are overridden by another provider
+	// in the container being visualized, but are still used by some
+	// constructors.
+	Shadowed bool
 }
 
 func (n *Node) nodeKey() nodeKey {
-	return nodeKey{t: n.Type, name: n.Name, group: n.Group}
+	return nodeKey{t: n.Type, name: n.Name, group: n.Group, shadowed: n.Shadowed}
 }
 
 // Param is a parameter node in the graph. Parameters are the input to constructors.
@@ -121,6 +151,41 @@ func (g *Group) removeResult(r *Result) {
 	g.Results = pruned
 }
 
+// Decorator is a decorator node in the graph. The decorators of a value form
+// a chain in which each decorator receives the value returned by the previous
+// one.
+type Decorator struct {
+	Name     string
+	Package  string
+	File     string
+	Line     int
+	CallFile string // file of the call which registered the decorator
+	CallLine int
+
+	// Value is the value being decorated.
+	Value *Node
+
+	// Position of the decorator in the chain of decorators of Value,
+	// starting at 1.
+	Position int
+
+	id       string
+	receives string
+}
+
+// ID returns the identifier of the decorator node.
+func (d *Decorator) ID() string { return d.id }
+
+// Receives returns the identifier of the node whose value is received by the
+// decorator: the decorated value for the first decorator of a chain, and the
+// previous decorator otherwise.
+func (d *Decorator) Receives() string { return d.receives }
+
+// Label returns the label of the decorator node.
+func (d *Decorator) Label() string {
+	return fmt.Sprintf("%v (%d)%v", d.Name, d.Position, registeredAt(d.File, d.CallFile, d.CallLine))
+}
+
 // Graph is the DOT-format graph in a Container.
 type Graph struct {
 	Ctors   []*Ctor
@@ -129,6 +194,8 @@ type Graph struct {
 	Groups   []*Group
 	groupMap map[nodeKey]*Group
 
+	Decorators []*Decorator
+
 	consumers map[nodeKey][]*Ctor
 
 	Failed *FailedNodes
@@ -154,6 +221,11 @@ type FailedNodes struct {
 	groups map[nodeKey]struct{}
 }
 
+// hasRootCause reports whether a root cause of failure was already found.
+func (f *FailedNodes) hasRootCause() bool {
+	return len(f.RootCauses) > 0 || len(f.groups) > 0
+}
+
 // NewGraph creates an empty graph.
 func NewGraph() *Graph {
 	return &Graph{
@@ -230,7 +302,7 @@ func (dg *Graph) failNode(r *Result, isRootCause bool) {
 // AddMissingNodes adds missing nodes to the list of failed Results in the graph.
 func (dg *Graph) AddMissingNodes(results []*Result) {
 	// The failure(s) are root causes if there are no other failures.
-	isRootCause := len(dg.Failed.RootCauses) == 0
+	isRootCause := !dg.Failed.hasRootCause()
 
 	for _, r := range results {
 		dg.failNode(r, isRootCause)
@@ -241,7 +313,7 @@ func (dg *Graph) AddMissingNodes(results []*Result) {
 // updates the state of the constructor with the given id accordingly.
 func (dg *Graph) FailNodes(results []*Result, id CtorID) {
 	// This failure is the root cause if there are no other failures.
-	isRootCause := len(dg.Failed.RootCauses) == 0
+	isRootCause := !dg.Failed.hasRootCause()
 	dg.Failed.ctors[id] = struct{}{}
 
 	for _, r := range results {
@@ -257,12 +329,20 @@ func (dg *Graph) FailNodes(results []*Result, id CtorID) {
 	}
 }
 
+// SetAttempts records the number of times the constructor with the given id
+// was called before it failed.
+func (dg *Graph) SetAttempts(id CtorID, attempts int) {
+	if c, ok := dg.ctorMap[id]; ok {
+		c.Attempts = attempts
+	}
+}
+
 // FailGroupNodes finds and adds the failed grouped nodes to the list of failed
 // Results in the graph, and updates the state of the group and constructor
 // with the given id accordingly.
 func (dg *Graph) FailGroupNodes(name string, t reflect.Type, id CtorID) {
 	// This failure is the root cause if there are no other failures.
-	isRootCause := len(dg.Failed.RootCauses) == 0
+	isRootCause := !dg.Failed.hasRootCause()
 
 	k := nodeKey{t: t, group: name}
 	group := dg.getGroup(k)
@@ -293,6 +373,23 @@ func (dg *Graph) FailGroupNodes(name string, t reflect.Type, id CtorID) {
 	}
 }
 
+// FailGroup marks the group with the given name and type as failed. It is
+// used when the group itself is invalid rather than any of its values.
+func (dg *Graph) FailGroup(name string, t reflect.Type) {
+	// This failure is the root cause if there are no other failures.
+	isRootCause := !dg.Failed.hasRootCause()
+
+	k := nodeKey{t: t, group: name}
+	group := dg.getGroup(k)
+	dg.Failed.groups[k] = struct{}{}
+
+	if isRootCause {
+		group.ErrorType = rootCause
+	} else {
+		group.ErrorType = transitiveFailure
+	}
+}
+
 // getGroup finds the group by nodeKey from the graph. If it is not available,
 // a new group is created and returned.
 func (dg *Graph) getGroup(k nodeKey) *Group {
@@ -314,12 +411,28 @@ func (dg *Graph) addToGroup(r *Result, id CtorID) {
 	group.Results = append(group.Results, r)
 }
 
+// AddDecorators adds a chain of decorators of the same value to the graph, in
+// the order in which they are applied.
+func (dg *Graph) AddDecorators(chain []*Decorator) {
+	for i, d := range chain {
+		d.Position = i + 1
+		d.id = fmt.Sprintf("decorator_%d", len(dg.Decorators))
+		if i == 0 {
+			d.receives = (&Result{Node: d.Value}).String()
+		} else {
+			d.receives = chain[i-1].id
+		}
+		dg.Decorators = append(dg.Decorators, d)
+	}
+}
+
 // PruneSuccess removes elements from the graph that do not have failed results.
 // Removing elements that do not have failing results makes the graph easier to debug,
 // since non-failing nodes and edges can clutter the graph and don't help the user debug.
 func (dg *Graph) PruneSuccess() {
 	dg.pruneCtors(dg.Failed.ctors)
 	dg.pruneGroups(dg.Failed.groups)
+	dg.Decorators = nil
 }
 
 // pruneCtors removes constructors from the graph that do not have failing Results.
@@ -401,22 +514,31 @@ func (dg *Graph) pruneGroupResults(c *Ctor, groups map[nodeKey]*Group) {
 
 // String implements fmt.Stringer for Param.
 func (p *Param) String() string {
+	s := p.Type.String()
 	if p.Name != "" {
-		return fmt.Sprintf("%v[name=%v]", p.Type.String(), p.Name)
+		s = fmt.Sprintf("%v[name=%v]", s, p.Name)
+	}
+	if p.Shadowed {
+		s += "[shadowed]"
 	}
-	return p.Type.String()
+	return s
 }
 
 // String implements fmt.Stringer for Result.
 func (r *Result) String() string {
+	var s string
 	switch {
 	case r.Name != "":
-		return fmt.Sprintf("%v[name=%v]", r.Type.String(), r.Name)
+		s = fmt.Sprintf("%v[name=%v]", r.Type.String(), r.Name)
 	case r.Group != "":
-		return fmt.Sprintf("%v[group=%v]%v", r.Type.String(), r.Group, r.GroupIndex)
+		s = fmt.Sprintf("%v[group=%v]%v", r.Type.String(), r.Group, r.GroupIndex)
 	default:
-		return r.Type.String()
+		s = r.Type.String()
+	}
+	if r.Shadowed {
+		s += "[shadowed]"
 	}
+	return s
 }
 
 // String implements fmt.Stringer for Group.
@@ -426,14 +548,19 @@ func (g *Group) String() string {
 
 // Attributes composes and returns a string of the Result node's attributes.
 func (r *Result) Attributes() string {
+	var attr string
 	switch {
 	case r.Name != "":
-		return fmt.Sprintf(`label=<%v<BR /><FONT POINT-SIZE="10">Name: %v</FONT>>`, r.Type, r.Name)
+		attr = fmt.Sprintf(`label=<%v<BR /><FONT POINT-SIZE="10">Name: %v</FONT>>`, r.Type, r.Name)
 	case r.Group != "":
-		return fmt.Sprintf(`label=<%v<BR /><FONT POINT-SIZE="10">Group: %v</FONT>>`, r.Type, r.Group)
+		attr = fmt.Sprintf(`label=<%v<BR /><FONT POINT-SIZE="10">Group: %v</FONT>>`, r.Type, r.Group)
 	default:
-		return fmt.Sprintf(`label=<%v>`, r.Type)
+		attr = fmt.Sprintf(`label=<%v>`, r.Type)
 	}
+	if r.Shadowed {
+		attr += " style=dashed"
+	}
+	return attr
 }
 
 // Attributes composes and returns a string of the Group node's attributes.
@@ -125,6 +125,55 @@ func TestAddCtor(t *testing.T) {
 	})
 }
 
+func TestAddDecorators(t *testing.T) {
+	dg := NewGraph()
+	n1 := &Node{Type: reflect.TypeOf(t1{})}
+	n2 := &Node{Type: reflect.TypeOf(t2{}), Name: "bar"}
+
+	d1 := &Decorator{Name: "d1", Value: n1}
+	d2 := &Decorator{Name: "d2", Value: n1}
+	d3 := &Decorator{Name: "d3", Value: n2}
+	dg.AddDecorators([]*Decorator{d1, d2})
+	dg.AddDecorators([]*Decorator{d3})
+
+	assert.Equal(t, []*Decorator{d1, d2, d3}, dg.Decorators)
+
+	assert.Equal(t, "decorator_0", d1.ID())
+	assert.Equal(t, "dot.t1", d1.Receives())
+	assert.Equal(t, "d1 (1)", d1.Label())
+
+	assert.Equal(t, "decorator_1", d2.ID())
+	assert.Equal(t, "decorator_0", d2.Receives())
+	assert.Equal(t, "d2 (2)", d2.Label())
+
+	assert.Equal(t, "decorator_2", d3.ID())
+	assert.Equal(t, "dot.t2[name=bar]", d3.Receives())
+	assert.Equal(t, "d3 (1)", d3.Label())
+
+	dg.PruneSuccess()
+	assert.Empty(t, dg.Decorators)
+}
+
+func TestLabels(t *testing.T) {
+	c := &Ctor{Name: "NewFoo", File: "foo/foo.go"}
+	assert.Equal(t, "NewFoo", c.Label())
+
+	c.CallFile, c.CallLine = "foo/foo.go", 12
+	assert.Equal(t, "NewFoo", c.Label(), "call sites in the same file must be omitted")
+
+	c.CallFile = "cmd/main.go"
+	assert.Equal(t, "NewFoo\nregistered at main.go:12", c.Label())
+
+	d := &Decorator{Name: "decorate", File: "foo/foo.go", Position: 2, CallFile: "cmd/main.go", CallLine: 13}
+	assert.Equal(t, "decorate (2)\nregistered at main.go:13", d.Label())
+
+	c.Attempts = 1
+	assert.Equal(t, "NewFoo\nregistered at main.go:12", c.Label(), "a single attempt must be omitted")
+
+	c.Attempts = 3
+	assert.Equal(t, "NewFoo\nregistered at main.go:12\nfailed after 3 attempts", c.Label())
+}
+
 func TestFailNodes(t *testing.T) {
 	type1 := reflect.TypeOf(&t1{})
 	type2 := reflect.TypeOf(&t2{})
@@ -194,6 +243,22 @@ func TestFailNodes(t *testing.T) {
 		assert.Equal(t, transitiveFailure, c1.ErrorType)
 		assert.Equal(t, transitiveFailure, dg.groupMap[k1].ErrorType)
 	})
+
+	t.Run("fail group", func(t *testing.T) {
+		dg := NewGraph()
+		c0 := &Ctor{ID: 123}
+		k0 := nodeKey{t: type1, group: "foo"}
+
+		dg.AddCtor(c0, []*Param{}, []*Result{r2})
+
+		dg.FailGroup("foo", type1)
+		assert.Equal(t, 0, len(dg.Failed.RootCauses))
+		assert.Equal(t, rootCause, dg.groupMap[k0].ErrorType)
+
+		dg.FailNodes([]*Result{r2}, 123)
+		assert.Equal(t, []*Result{r2}, dg.Failed.TransitiveFailures)
+		assert.Equal(t, transitiveFailure, c0.ErrorType)
+	})
 }
 
 func TestPruneSuccess(t *testing.T) {
@@ -406,13 +471,16 @@ func TestStringerAndAttribute(t *testing.T) {
 	n1 := &Node{Type: type1}
 	n2 := &Node{Type: type2, Name: "bar"}
 	n3 := &Node{Type: type3, Group: "foo"}
+	n4 := &Node{Type: type2, Name: "bar", Shadowed: true}
 
 	p1 := &Param{Node: n1}
 	p2 := &Param{Node: n2}
+	p4 := &Param{Node: n4}
 
 	r1 := &Result{Node: n1}
 	r2 := &Result{Node: n2}
 	r3 := &Result{Node: n3, GroupIndex: 5}
+	r4 := &Result{Node: n4}
 
 	g1 := &Group{Type: reflect.TypeOf(t1{}), Name: "group1"}
 	g2 := &Group{Type: reflect.TypeOf(t2{}), Name: "group2", ErrorType: rootCause}
@@ -423,12 +491,14 @@ func TestStringerAndAttribute(t *testing.T) {
 	t.Run("param stringer", func(t *testing.T) {
 		assert.Equal(t, "dot.t1", p1.String())
 		assert.Equal(t, "dot.t2[name=bar]", p2.String())
+		assert.Equal(t, "dot.t2[name=bar][shadowed]", p4.String())
 	})
 
 	t.Run("result stringer", func(t *testing.T) {
 		assert.Equal(t, "dot.t1", r1.String())
 		assert.Equal(t, "dot.t2[name=bar]", r2.String())
 		assert.Equal(t, "dot.t3[group=foo]5", r3.String())
+		assert.Equal(t, "dot.t2[name=bar][shadowed]", r4.String())
 	})
 
 	t.Run("group stringer", func(t *testing.T) {
@@ -439,6 +509,7 @@ func TestStringerAndAttribute(t *testing.T) {
 		assert.Equal(t, `label=<dot.t1>`, r1.Attributes())
 		assert.Equal(t, `label=<dot.t2<BR /><FONT POINT-SIZE="10">Name: bar</FONT>>`, r2.Attributes())
 		assert.Equal(t, `label=<dot.t3<BR /><FONT POINT-SIZE="10">Group: foo</FONT>>`, r3.Attributes())
+		assert.Equal(t, `label=<dot.t2<BR /><FONT POINT-SIZE="10">Name: bar</FONT>> style=dashed`, r4.Attributes())
 	})
 
 	t.Run("group attributes", func(t *testing.T) {
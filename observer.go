@@ -0,0 +1,295 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"reflect"
+	"time"
+
+	"go.uber.org/dig/internal/digreflect"
+)
+
+// An Observer is notified of the activity of a container. Observers are set
+// with the WithObserver option.
+//
+// Observers are called synchronously from the goroutine which caused the
+// event. As values may be built concurrently from request scopes, observers
+// must be safe for concurrent use.
+type Observer interface {
+	// Observe is called with one of the events defined in this package:
+	// ProvideEvent, DecorateEvent, ConstructorStartEvent,
+	// ConstructorFinishEvent, InvokeStartEvent, InvokeFinishEvent or
+	// GroupSubmitEvent.
+	Observe(Event)
+}
+
+// ObserverFunc is an Observer defined by a function.
+type ObserverFunc func(Event)
+
+// Observe calls f with the event.
+func (f ObserverFunc) Observe(e Event) { f(e) }
+
+// WithObserver is an Option which notifies the given observer of the
+// activity of the container and its children.
+//
+//   c := dig.New(dig.WithObserver(dig.ObserverFunc(func(e dig.Event) {
+//     if e, ok := e.(dig.ConstructorFinishEvent); ok {
+//       log.Printf("%v took %v", e.Func, e.Duration)
+//     }
+//   })))
+func WithObserver(o Observer) Option {
+	return optionFunc(func(c *Container) {
+		c.observer = o
+	})
+}
+
+// Event is an event reported to an Observer.
+type Event interface {
+	event()
+}
+
+// Key identifies a value in a container. Only one of Name or Group is set.
+type Key struct {
+	Type  reflect.Type
+	Name  string
+	Group string
+}
+
+func (k Key) String() string {
+	return key{t: k.Type, name: k.Name, group: k.Group}.String()
+}
+
+// ProvideEvent is reported when a constructor is provided to a container.
+type ProvideEvent struct {
+	// Identifier of the constructor.
+	ID NodeID
+
+	// Location of the constructor.
+	Func *digreflect.Func
+
+	// Path of the container the constructor was provided to.
+	Container string
+
+	// Values produced by the constructor, ordered by their string
+	// representation. Keys is empty if Err is set.
+	Keys []Key
+
+	// Error returned by Provide, if any.
+	Err error
+}
+
+// DecorateEvent is reported when a decorator is registered with a
+// container.
+type DecorateEvent struct {
+	// Identifier of the decorator.
+	ID NodeID
+
+	// Location of the decorator.
+	Func *digreflect.Func
+
+	// Path of the container the decorator was registered with.
+	Container string
+
+	// Values decorated by the decorator, ordered by their string
+	// representation. For element decorators, this is the value group.
+	// Keys is empty if Err is set.
+	Keys []Key
+
+	// Error returned by Decorate, if any.
+	Err error
+}
+
+// ConstructorStartEvent is reported before a constructor or a decorator is
+// called. Its dependencies have already been built at that point.
+type ConstructorStartEvent struct {
+	// Identifier of the constructor.
+	ID NodeID
+
+	// Location of the constructor.
+	Func *digreflect.Func
+
+	// Path of the container the constructor was provided to.
+	Container string
+}
+
+// ConstructorFinishEvent is reported after a constructor or a decorator
+// returned.
+type ConstructorFinishEvent struct {
+	// Identifier of the constructor.
+	ID NodeID
+
+	// Location of the constructor.
+	Func *digreflect.Func
+
+	// Path of the container the constructor was provided to.
+	Container string
+
+	// Time spent in the constructor itself, excluding its dependencies.
+	Duration time.Duration
+
+	// Error returned by the constructor, if any.
+	Err error
+}
+
+// InvokeStartEvent is reported when Invoke is called.
+type InvokeStartEvent struct {
+	// Location of the invoked function.
+	Func *digreflect.Func
+
+	// Path of the container the function was invoked on.
+	Container string
+}
+
+// InvokeFinishEvent is reported when Invoke returns.
+type InvokeFinishEvent struct {
+	// Location of the invoked function.
+	Func *digreflect.Func
+
+	// Path of the container the function was invoked on.
+	Container string
+
+	// Time spent in Invoke, including building the dependencies of the
+	// function.
+	Duration time.Duration
+
+	// Error returned by Invoke, if any.
+	Err error
+}
+
+// GroupSubmitEvent is reported when a constructor adds values to a value
+// group. It is reported once per value group.
+type GroupSubmitEvent struct {
+	// Identifier of the constructor.
+	ID NodeID
+
+	// Location of the constructor.
+	Func *digreflect.Func
+
+	// Path of the container the constructor was provided to.
+	Container string
+
+	// Value group the values were added to.
+	Key Key
+
+	// Number of values added to the group. Element decorators are applied
+	// to the values when the group is consumed, so they are not accounted
+	// for.
+	Count int
+}
+
+func (ProvideEvent) event()           {}
+func (DecorateEvent) event()          {}
+func (ConstructorStartEvent) event()  {}
+func (ConstructorFinishEvent) event() {}
+func (InvokeStartEvent) event()       {}
+func (InvokeFinishEvent) event()      {}
+func (GroupSubmitEvent) event()       {}
+
+func exportKeys(keys []key) []Key {
+	if len(keys) == 0 {
+		return nil
+	}
+	exported := make([]Key, len(keys))
+	for i, k := range keys {
+		exported[i] = Key{Type: k.t, Name: k.name, Group: k.group}
+	}
+	return exported
+}
+
+// observeInvoke reports the start of an Invoke of function to o, and returns
+// a function which reports its end given the error returned by Invoke.
+func observeInvoke(o Observer, function interface{}, path string) func(*error) {
+	f := digreflect.InspectFunc(function)
+	o.Observe(InvokeStartEvent{Func: f, Container: path})
+	start := time.Now()
+	return func(err *error) {
+		o.Observe(InvokeFinishEvent{
+			Func:      f,
+			Container: path,
+			Duration:  time.Since(start),
+			Err:       *err,
+		})
+	}
+}
+
+// observeGroups reports the values of value groups received by sr from the
+// constructor of n to o, if it's non-nil.
+func (n *node) observeGroups(o Observer, sr *stagingContainerWriter) {
+	if o == nil {
+		return
+	}
+
+	counts := make(map[key]int)
+	for k, vs := range sr.groups {
+		counts[k] += len(vs)
+	}
+	for k, vs := range sr.keyedGroups {
+		counts[k] += len(vs)
+	}
+
+	keys := make([]key, 0, len(counts))
+	for k, n := range counts {
+		if n > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sortKeys(keys)
+
+	path := n.containerFullPath()
+	for _, k := range keys {
+		o.Observe(GroupSubmitEvent{
+			ID:        n.id,
+			Func:      n.location,
+			Container: path,
+			Key:       Key{Type: k.t, Group: k.group},
+			Count:     counts[k],
+		})
+	}
+}
+
+// containerFullPath returns the path of the container n was provided to, or
+// an empty string if it was not provided to a container.
+func (n *node) containerFullPath() string {
+	if n.providedTo == nil {
+		return ""
+	}
+	return n.providedTo.Path()
+}
+
+// observerOf returns the observer of the container backing c, if any.
+func observerOf(c containerStore) Observer {
+	if cc := containerOf(c); cc != nil {
+		return cc.observer
+	}
+	return nil
+}
+
+// containerOf returns the container backing c: either c itself, or the
+// parent of a request scope.
+func containerOf(c containerStore) *Container {
+	switch c := c.(type) {
+	case *Container:
+		return c
+	case *RequestScope:
+		return c.scopes.parent
+	}
+	return nil
+}
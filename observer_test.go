@@ -0,0 +1,234 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingObserver records the events reported to it.
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (o *recordingObserver) Observe(e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, e)
+}
+
+// Summary returns a short description of each recorded event.
+func (o *recordingObserver) Summary() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	summary := make([]string, len(o.events))
+	for i, e := range o.events {
+		switch e := e.(type) {
+		case ProvideEvent:
+			summary[i] = fmt.Sprintf("provide %v in %v: %v", e.Func.Name, e.Container, e.Keys)
+		case DecorateEvent:
+			summary[i] = fmt.Sprintf("decorate %v in %v: %v", e.Func.Name, e.Container, e.Keys)
+		case ConstructorStartEvent:
+			summary[i] = fmt.Sprintf("start %v in %v", e.Func.Name, e.Container)
+		case ConstructorFinishEvent:
+			summary[i] = fmt.Sprintf("finish %v in %v", e.Func.Name, e.Container)
+		case InvokeStartEvent:
+			summary[i] = fmt.Sprintf("invoke %v in %v", e.Func.Name, e.Container)
+		case InvokeFinishEvent:
+			summary[i] = fmt.Sprintf("invoked %v in %v", e.Func.Name, e.Container)
+		case GroupSubmitEvent:
+			summary[i] = fmt.Sprintf("submit %d to %v", e.Count, e.Key)
+		}
+	}
+	return summary
+}
+
+type observedA struct{}
+type observedB struct{}
+
+func newObservedA() *observedA                  { return &observedA{} }
+func newObservedB(*observedA) *observedB        { return &observedB{} }
+func decorateObservedA(a *observedA) *observedA { return a }
+func useObservedB(*observedB)                   {}
+
+func newObservedName() string              { return "a" }
+func decorateObservedName(s string) string { return s }
+
+func TestObserver(t *testing.T) {
+	t.Run("reports container activity", func(t *testing.T) {
+		var o recordingObserver
+		c := New(WithObserver(&o))
+		child := c.Child("child")
+
+		require.NoError(t, c.Provide(newObservedA), "provide failed")
+		require.NoError(t, child.Provide(newObservedB), "provide failed")
+		require.NoError(t, c.Decorate(decorateObservedA), "decorate failed")
+		require.NoError(t, child.Invoke(useObservedB), "invoke failed")
+
+		assert.Equal(t, []string{
+			"provide newObservedA in root: [*dig.observedA]",
+			"provide newObservedB in root/child: [*dig.observedB]",
+			"decorate decorateObservedA in root: [*dig.observedA]",
+			"invoke useObservedB in root/child",
+			"start newObservedA in root",
+			"finish newObservedA in root",
+			"start decorateObservedA in root",
+			"finish decorateObservedA in root",
+			"start newObservedB in root/child",
+			"finish newObservedB in root/child",
+			"invoked useObservedB in root/child",
+		}, o.Summary())
+	})
+
+	t.Run("events carry node IDs", func(t *testing.T) {
+		var o recordingObserver
+		c := New(WithObserver(&o))
+		require.NoError(t, c.Provide(newObservedA), "provide failed")
+		require.NoError(t, c.Provide(newObservedA, Name("again")), "provide failed")
+		require.NoError(t, c.Invoke(func(struct {
+			In
+
+			A *observedA `name:"again"`
+		}) {
+		}), "invoke failed")
+
+		require.Len(t, o.events, 6)
+		assert.Equal(t, NodeID(1), o.events[0].(ProvideEvent).ID)
+		assert.Equal(t, NodeID(2), o.events[1].(ProvideEvent).ID)
+		assert.Equal(t, NodeID(2), o.events[3].(ConstructorStartEvent).ID)
+		assert.Equal(t, NodeID(2), o.events[4].(ConstructorFinishEvent).ID)
+	})
+
+	t.Run("reports errors", func(t *testing.T) {
+		var o recordingObserver
+		c := New(WithObserver(&o))
+
+		err := c.Provide(func() {})
+		require.Error(t, err, "provide must fail")
+		require.NoError(t, c.Provide(func() (*observedA, error) {
+			return nil, errors.New("great sadness")
+		}), "provide failed")
+		invokeErr := c.Invoke(useObservedB)
+		require.Error(t, invokeErr, "invoke must fail")
+		buildErr := c.Invoke(func(*observedA) {})
+		require.Error(t, buildErr, "invoke must fail")
+
+		require.Len(t, o.events, 8)
+
+		provide := o.events[0].(ProvideEvent)
+		assert.Equal(t, err, provide.Err)
+		assert.Empty(t, provide.Keys)
+
+		assert.Equal(t, invokeErr, o.events[3].(InvokeFinishEvent).Err)
+
+		finish := o.events[6].(ConstructorFinishEvent)
+		require.Error(t, finish.Err)
+		assert.Contains(t, finish.Err.Error(), "great sadness")
+		assert.Equal(t, buildErr, o.events[7].(InvokeFinishEvent).Err)
+	})
+
+	t.Run("reports group submissions", func(t *testing.T) {
+		type out struct {
+			Out
+
+			Values []string `group:"values,flatten"`
+			Keyed  string   `group:"values" key:"k"`
+		}
+
+		var o recordingObserver
+		c := New(WithObserver(&o))
+		require.NoError(t, c.Provide(func() out {
+			return out{Values: []string{"a", "b"}, Keyed: "c"}
+		}), "provide failed")
+		require.NoError(t, c.Provide(func() int { return 42 }, Group("ints")), "provide failed")
+		require.NoError(t, c.Invoke(func(struct {
+			In
+
+			Values []string `group:"values"`
+			Ints   []int    `group:"ints"`
+		}) {
+		}), "invoke failed")
+
+		var submitted []string
+		for _, e := range o.events {
+			if e, ok := e.(GroupSubmitEvent); ok {
+				submitted = append(submitted, fmt.Sprintf("%d to %v", e.Count, e.Key))
+			}
+		}
+		assert.ElementsMatch(t, []string{`3 to string[group="values"]`, `1 to int[group="ints"]`}, submitted)
+	})
+
+	t.Run("reports element decorators", func(t *testing.T) {
+		var o recordingObserver
+		c := New(WithObserver(&o))
+		require.NoError(t, c.Provide(newObservedName, Group("names")), "provide failed")
+		require.NoError(t, c.Decorate(decorateObservedName, Group("names")), "decorate failed")
+
+		o.events = nil
+		require.NoError(t, c.Invoke(func(struct {
+			In
+
+			Names []string `group:"names"`
+		}) {
+		}), "invoke failed")
+
+		summary := o.Summary()
+		require.Len(t, summary, 7)
+		assert.Equal(t, []string{
+			"start newObservedName in root",
+			"finish newObservedName in root",
+			`submit 1 to string[group="names"]`,
+			"start decorateObservedName in root",
+			"finish decorateObservedName in root",
+		}, summary[1:6])
+		assert.Equal(t, NodeID(2), o.events[4].(ConstructorStartEvent).ID)
+	})
+
+	t.Run("reports request scopes", func(t *testing.T) {
+		var o recordingObserver
+		c := New(WithObserver(&o))
+		require.NoError(t, c.Provide(newObservedA), "provide failed")
+
+		scopes := c.RequestScopes()
+		require.NoError(t, scopes.Provide(newObservedB), "provide failed")
+		s, err := scopes.New()
+		require.NoError(t, err, "new failed")
+
+		o.events = nil
+		require.NoError(t, s.Invoke(useObservedB), "invoke failed")
+		assert.Equal(t, []string{
+			"invoke useObservedB in root",
+			"start newObservedA in root",
+			"finish newObservedA in root",
+			"start newObservedB in root",
+			"finish newObservedB in root",
+			"invoked useObservedB in root",
+		}, o.Summary())
+	})
+}
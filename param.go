@@ -36,9 +36,10 @@ import (
 //  paramObject   dig.In struct where each field in the struct can be another
 //                param.
 //  paramGroupedSlice
-//                A slice consuming a value group. This will receive all
-//                values produced with a `group:".."` tag with the same name
-//                as a slice.
+//                A slice or map consuming a value group. This will receive
+//                all values produced with a `group:".."` tag with the same
+//                name as a slice, or all values produced with a key as a
+//                map.
 type param interface {
 	fmt.Stringer
 
@@ -234,7 +235,13 @@ func (ps paramSingle) DotParam() []*dot.Param {
 }
 
 func (ps paramSingle) Build(c containerStore) (reflect.Value, error) {
-	if v, ok := c.getValue(ps.Name, ps.Type); ok {
+	if s, ok := c.(*RequestScope); ok && !s.isScoped(key{name: ps.Name, t: ps.Type}) {
+		return s.buildInParent(ps)
+	}
+
+	// A value built in an ancestor of c may still have to be decorated by
+	// the decorators of c.
+	if v, ok := c.getValue(ps.Name, ps.Type); ok && !ps.hasPendingDecorators(c) {
 		return v, nil
 	}
 
@@ -247,7 +254,7 @@ func (ps paramSingle) Build(c containerStore) (reflect.Value, error) {
 	}
 
 	for _, n := range providers {
-		err := n.Call(c)
+		err := callProvider(c, key{name: ps.Name, t: ps.Type}, n)
 		if err == nil {
 			continue
 		}
@@ -271,10 +278,29 @@ func (ps paramSingle) Build(c containerStore) (reflect.Value, error) {
 	}
 }
 
-func (ps paramSingle) Decorate(c containerStore) (reflect.Value, error) {
+// hasPendingDecorators reports whether any of the decorators of this param
+// which are visible from c have yet to be applied.
+func (ps paramSingle) hasPendingDecorators(c containerStore) bool {
+	for _, n := range c.getDecorators(key{name: ps.Name, t: ps.Type}) {
+		if !n.called && !n.calling {
+			return true
+		}
+	}
+	return false
+}
 
+// Decorate applies the decorators of this param visible from c. Each
+// decorator receives the value returned by the previous one. The last
+// decorator is called first: building its parameters applies the decorators
+// before it.
+func (ps paramSingle) Decorate(c containerStore) (reflect.Value, error) {
 	decorators := c.getDecorators(key{name: ps.Name, t: ps.Type})
-	for _, n := range decorators {
+	for i := len(decorators) - 1; i >= 0; i-- {
+		n := decorators[i]
+		if n.calling {
+			// This decorator is building its own dependency on this value.
+			continue
+		}
 		err := n.Call(c)
 		if err == nil {
 			continue
@@ -424,15 +450,32 @@ func (pof paramObjectField) Decorate(c containerStore) (reflect.Value, error) {
 
 // paramGroupedSlice is a param which produces a slice of values with the same
 // group name.
+//
+// If the type is a map[string]T, the param instead produces all values of the
+// group that were submitted with a key, indexed by that key.
 type paramGroupedSlice struct {
 	// Name of the group as specified in the `group:".."` tag.
 	Group string
 
-	// Type of the slice.
+	// Type of the slice or map.
 	Type reflect.Type
+
+	// Soft is used to denote a soft dependency between this param and its
+	// constructors. If set, constructors of the group are not called to
+	// build this param; it receives only the values of those constructors
+	// that were already called.
+	Soft bool
+
+	// Min and Max bound the number of values this param may receive. Max is
+	// zero if the number of values is unbounded.
+	Min, Max int
 }
 
 func (pt paramGroupedSlice) DotParam() []*dot.Param {
+	if pt.Soft {
+		// Soft value groups don't depend on the constructors of the group.
+		return nil
+	}
 	return []*dot.Param{
 		{
 			Node: &dot.Node{
@@ -446,16 +489,33 @@ func (pt paramGroupedSlice) DotParam() []*dot.Param {
 // newParamGroupedSlice builds a paramGroupedSlice from the provided type with
 // the given name.
 //
-// The type MUST be a slice type.
+// The type MUST be a slice type or a map type with string keys.
 func newParamGroupedSlice(f reflect.StructField) (paramGroupedSlice, error) {
-	pg := paramGroupedSlice{Group: f.Tag.Get(_groupTag), Type: f.Type}
+	g, err := parseGroupString(f.Tag.Get(_groupTag))
+	if err != nil {
+		return paramGroupedSlice{}, errWrapf(err, "cannot parse group %q", f.Tag.Get(_groupTag))
+	}
+	pg := paramGroupedSlice{Group: g.Name, Type: f.Type, Soft: g.Soft, Min: g.Min, Max: g.Max}
 
 	name := f.Tag.Get(_nameTag)
 	optional, _ := isFieldOptional(f)
 	switch {
+	case g.Flatten:
+		return pg, fmt.Errorf(
+			"cannot use flatten in parameter value groups: field %q (%v) requests group:%q",
+			f.Name, f.Type, f.Tag.Get(_groupTag))
+	case len(g.Key) > 0:
+		return pg, fmt.Errorf(
+			"cannot use key in parameter value groups: field %q (%v) requests group:%q",
+			f.Name, f.Type, f.Tag.Get(_groupTag))
+	case f.Type.Kind() == reflect.Map:
+		if f.Type.Key().Kind() != reflect.String {
+			return pg, fmt.Errorf("value groups may be consumed as maps with string keys only: "+
+				"field %q (%v) does not have string keys", f.Name, f.Type)
+		}
 	case f.Type.Kind() != reflect.Slice:
-		return pg, fmt.Errorf("value groups may be consumed as slices only: "+
-			"field %q (%v) is not a slice", f.Name, f.Type)
+		return pg, fmt.Errorf("value groups may be consumed as slices or maps only: "+
+			"field %q (%v) is not a slice or a map", f.Name, f.Type)
 	case name != "":
 		return pg, fmt.Errorf(
 			"cannot use named values with value groups: name:%q requested with group:%q", name, pg.Group)
@@ -468,15 +528,20 @@ func newParamGroupedSlice(f reflect.StructField) (paramGroupedSlice, error) {
 }
 
 func (pt paramGroupedSlice) Build(c containerStore) (reflect.Value, error) {
-	if items, ok := c.getValueGroup(pt.Group, pt.Type.Elem()); ok {
-		result := reflect.MakeSlice(pt.Type, len(items), len(items))
-		for i, v := range items {
-			result.Index(i).Set(v)
-		}
-		return result, nil
+	// Request-scoped constructors cannot add values to value groups.
+	if s, ok := c.(*RequestScope); ok {
+		return s.buildInParent(pt)
+	}
+
+	if pt.Soft {
+		return pt.collect(c)
 	}
+
+	// Constructors that were already called are not called again, so this
+	// only calls the constructors which haven't contributed to the group
+	// yet.
 	for _, n := range c.getGroupProviders(pt.Group, pt.Type.Elem()) {
-		if err := n.Call(c); err != nil {
+		if err := callProvider(c, key{group: pt.Group, t: pt.Type.Elem()}, n); err != nil {
 			return _noValue, errParamGroupFailed{
 				CtorID: n.ID(),
 				Key:    key{group: pt.Group, t: pt.Type.Elem()},
@@ -491,18 +556,50 @@ func (pt paramGroupedSlice) Build(c containerStore) (reflect.Value, error) {
 	return val, nil
 }
 
+// Decorate returns the values of the group visible from c. Value groups are
+// not decorated as a whole: their values are decorated individually by
+// element decorators.
 func (pt paramGroupedSlice) Decorate(c containerStore) (reflect.Value, error) {
-	decs := c.getDecorators(key{t: pt.Type.Elem(), group: pt.Group})
-	for _, n := range decs {
-		if err := n.Call(c); err != nil {
-			return _noValue, err
+	return pt.collect(c)
+}
+
+// collect builds the value for this param from the values of the group
+// visible from c, decorated by the element decorators visible from c. If the
+// param is a map, it is built from the keyed values of the group only.
+//
+// An errGroupCardinality is returned if the number of values is outside of
+// the bounds of this param.
+func (pt paramGroupedSlice) collect(c containerStore) (reflect.Value, error) {
+	k := key{group: pt.Group, t: pt.Type.Elem()}
+
+	var result reflect.Value
+	if pt.Type.Kind() == reflect.Map {
+		items, err := c.getKeyedValueGroup(pt.Group, pt.Type.Elem())
+		if err != nil {
+			return _noValue, errParamGroupFailed{Key: k, Reason: err}
+		}
+		result = reflect.MakeMapWithSize(pt.Type, len(items))
+		for k, v := range items {
+			result.SetMapIndex(reflect.ValueOf(k).Convert(pt.Type.Key()), v)
+		}
+	} else {
+		items, err := c.getValueGroup(pt.Group, pt.Type.Elem())
+		if err != nil {
+			return _noValue, errParamGroupFailed{Key: k, Reason: err}
+		}
+		result = reflect.MakeSlice(pt.Type, len(items), len(items))
+		for i, v := range items {
+			result.Index(i).Set(v)
 		}
 	}
-	items, _ := c.getValueGroup(pt.Group, pt.Type.Elem())
 
-	result := reflect.MakeSlice(pt.Type, len(items), len(items))
-	for i, v := range items {
-		result.Index(i).Set(v)
+	if n := result.Len(); n < pt.Min || (pt.Max > 0 && n > pt.Max) {
+		return _noValue, errGroupCardinality{
+			Key:   k,
+			Min:   pt.Min,
+			Max:   pt.Max,
+			Count: n,
+		}
 	}
 	return result, nil
-}
\ No newline at end of file
+}
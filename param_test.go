@@ -131,8 +131,18 @@ func TestParamGroupSliceErrors(t *testing.T) {
 
 				Foo string `group:"foo"`
 			}{},
-			wantErr: "value groups may be consumed as slices only: " +
-				`field "Foo" (string) is not a slice`,
+			wantErr: "value groups may be consumed as slices or maps only: " +
+				`field "Foo" (string) is not a slice or a map`,
+		},
+		{
+			desc: "maps must have string keys",
+			shape: struct {
+				In
+
+				Foo map[int]string `group:"foo"`
+			}{},
+			wantErr: "value groups may be consumed as maps with string keys only: " +
+				`field "Foo" (map[int]string) does not have string keys`,
 		},
 		{
 			desc: "cannot provide name for a group",
@@ -153,6 +163,55 @@ func TestParamGroupSliceErrors(t *testing.T) {
 			}{},
 			wantErr: "value groups cannot be optional",
 		},
+		{
+			desc: "cannot flatten",
+			shape: struct {
+				In
+
+				Foo []string `group:"foo,flatten"`
+			}{},
+			wantErr: "cannot use flatten in parameter value groups: " +
+				`field "Foo" ([]string) requests group:"foo,flatten"`,
+		},
+		{
+			desc: "cannot request a key",
+			shape: struct {
+				In
+
+				Foo []string `group:"foo,key=bar"`
+			}{},
+			wantErr: "cannot use key in parameter value groups: " +
+				`field "Foo" ([]string) requests group:"foo,key=bar"`,
+		},
+		{
+			desc: "min must be a number",
+			shape: struct {
+				In
+
+				Foo []string `group:"foo,min=one"`
+			}{},
+			wantErr: `cannot parse group "foo,min=one": ` +
+				`invalid option "min=one": min must be a non-negative integer`,
+		},
+		{
+			desc: "max must be positive",
+			shape: struct {
+				In
+
+				Foo []string `group:"foo,max=0"`
+			}{},
+			wantErr: `cannot parse group "foo,max=0": ` +
+				`invalid option "max=0": max must be a positive integer`,
+		},
+		{
+			desc: "min cannot exceed max",
+			shape: struct {
+				In
+
+				Foo []string `group:"foo,min=2,max=1"`
+			}{},
+			wantErr: `cannot parse group "foo,min=2,max=1": min (2) cannot be greater than max (1)`,
+		},
 	}
 
 	for _, tt := range tests {
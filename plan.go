@@ -0,0 +1,283 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.uber.org/dig/internal/digreflect"
+)
+
+// Plan lists the constructors and decorators an Invoke would call. See
+// Container.Plan.
+type Plan struct {
+	// Constructors and decorators, in the order in which they would be
+	// called.
+	Steps []PlanStep
+
+	// Dependencies which are not provided to the container, ordered by their
+	// string representation. Invoke fails if any dependencies are missing.
+	Missing []Key
+}
+
+// PlanStep is a constructor or a decorator of a Plan.
+type PlanStep struct {
+	// Identifier of the constructor or decorator.
+	ID NodeID
+
+	// Location of the constructor or decorator.
+	Func *digreflect.Func
+
+	// Path of the container the constructor was provided to, or the
+	// decorator registered with.
+	Container string
+
+	// Whether the function is a decorator.
+	Decorator bool
+
+	// Values produced by the constructor, or decorated by the decorator,
+	// ordered by their string representation.
+	Keys []Key
+
+	// Whether the function was already called. Invoke doesn't call it
+	// again: its values are already built.
+	Built bool
+}
+
+// String formats the plan with a step per line, followed by the missing
+// dependencies, if any.
+//
+//   "path/to/package".NewConfig (path/to/config.go:12) in container "root" (built)
+//   "path/to/package".NewDB (path/to/db.go:42) in container "root"
+//   "path/to/package".WithMetrics (path/to/metrics.go:8) in container "root" (decorator)
+//   missing *cache.Client
+func (p Plan) String() string {
+	b := new(bytes.Buffer)
+	for _, s := range p.Steps {
+		fmt.Fprintf(b, "%v%v", s.Func, inContainer(s.Container))
+		if s.Decorator {
+			b.WriteString(" (decorator)")
+		}
+		if s.Built {
+			b.WriteString(" (built)")
+		}
+		b.WriteString("\n")
+	}
+	for _, k := range p.Missing {
+		fmt.Fprintf(b, "missing %v\n", k)
+	}
+	return b.String()
+}
+
+// Plan returns the constructors and decorators which Invoke would call to
+// build the arguments of the given function, without calling any of them.
+// The plan includes the constructors and decorators which were already
+// called, marked as built, and the dependencies which are missing.
+//
+//   p, err := c.Plan(runMigrations)
+//   if err != nil {
+//     return err
+//   }
+//   fmt.Print(p)
+//
+// Invoke may call fewer functions than planned if one of them fails, or if
+// dependencies are missing.
+func (c *Container) Plan(function interface{}) (Plan, error) {
+	ftype := reflect.TypeOf(function)
+	if ftype == nil {
+		return Plan{}, errors.New("can't plan an untyped nil")
+	}
+	if ftype.Kind() != reflect.Func {
+		return Plan{}, fmt.Errorf("can't plan non-function %v (type %v)", function, ftype)
+	}
+
+	pl, err := newParamList(ftype)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	p := planner{
+		keys:     make(map[planKey]struct{}),
+		nodes:    make(map[*node]struct{}),
+		elements: make(map[*elementDecorator]struct{}),
+		missing:  make(map[key]struct{}),
+	}
+	p.params(c, pl)
+
+	missing := make([]key, 0, len(p.missing))
+	for k := range p.missing {
+		missing = append(missing, k)
+	}
+	sortKeys(missing)
+	return Plan{Steps: p.steps, Missing: exportKeys(missing)}, nil
+}
+
+// planKey identifies a value resolved from a container.
+type planKey struct {
+	c containerStore
+	k key
+}
+
+// planner builds a Plan by visiting the dependencies of a function in the
+// order in which Invoke builds them.
+type planner struct {
+	steps []PlanStep
+
+	// Values, constructors and decorators visited so far. Values are marked
+	// when they are first visited so that decorators, which depend on the
+	// values they decorate, and cycles are only visited once.
+	keys     map[planKey]struct{}
+	nodes    map[*node]struct{}
+	elements map[*elementDecorator]struct{}
+
+	missing map[key]struct{}
+}
+
+// params visits the dependencies in the given param resolved from c.
+func (p *planner) params(c containerStore, pl param) {
+	walkParam(pl, paramVisitorFunc(func(param param) bool {
+		switch param := param.(type) {
+		case paramSingle:
+			p.single(c, param)
+		case paramGroupedSlice:
+			p.group(c, param)
+		default:
+			// Recurse for non-edge params.
+			return true
+		}
+		return false
+	}))
+}
+
+func (p *planner) single(c containerStore, ps paramSingle) {
+	k := key{name: ps.Name, t: ps.Type}
+	if _, ok := p.keys[planKey{c, k}]; ok {
+		return
+	}
+	p.keys[planKey{c, k}] = struct{}{}
+
+	providers := c.getValueProviders(ps.Name, ps.Type)
+	if len(providers) == 0 {
+		if _, ok := c.getValue(ps.Name, ps.Type); !ok && !ps.Optional {
+			p.missing[k] = struct{}{}
+		}
+		return
+	}
+
+	for _, n := range providers {
+		p.node(c, n, false /* decorator */)
+	}
+	for _, n := range c.getDecorators(k) {
+		p.node(c, n, true /* decorator */)
+	}
+}
+
+func (p *planner) group(c containerStore, pt paramGroupedSlice) {
+	k := key{group: pt.Group, t: pt.Type.Elem()}
+	if _, ok := p.keys[planKey{c, k}]; ok {
+		return
+	}
+	p.keys[planKey{c, k}] = struct{}{}
+
+	providers := c.getGroupProviders(pt.Group, pt.Type.Elem())
+	if len(providers) == 0 && pt.Min > 0 {
+		p.missing[k] = struct{}{}
+	}
+	// Soft groups only receive the values which are already built.
+	if !pt.Soft {
+		for _, n := range providers {
+			p.node(c, n, false /* decorator */)
+		}
+	}
+
+	// The values of the group are decorated when they are consumed.
+	for _, d := range c.getElementDecorators(k) {
+		p.element(d.container, k, d)
+	}
+}
+
+// node visits the dependencies of the constructor or decorator n called from
+// c, followed by n itself.
+func (p *planner) node(c containerStore, n provider, decorator bool) {
+	nn, ok := n.(*node)
+	if !ok {
+		return
+	}
+	if _, ok := p.nodes[nn]; ok {
+		return
+	}
+	p.nodes[nn] = struct{}{}
+
+	step := PlanStep{
+		ID:        nn.id,
+		Func:      nn.location,
+		Container: nn.containerFullPath(),
+		Decorator: decorator,
+		Keys:      exportKeys(resultKeys(nn.resultList)),
+		Built:     nn.called,
+	}
+	if nn.called {
+		p.steps = append(p.steps, step)
+		return
+	}
+
+	c = nn.Scope(c)
+	p.params(c, nn.paramList)
+	p.steps = append(p.steps, step)
+}
+
+// element visits the dependencies of the element decorator d of the values
+// with the given key, followed by d itself.
+func (p *planner) element(c containerStore, k key, d *elementDecorator) {
+	if _, ok := p.elements[d]; ok {
+		return
+	}
+	p.elements[d] = struct{}{}
+
+	p.params(c, d.deps)
+	p.steps = append(p.steps, PlanStep{
+		ID:        d.id,
+		Func:      d.location,
+		Container: d.container.Path(),
+		Decorator: true,
+		Keys:      exportKeys([]key{k}),
+	})
+}
+
+// resultKeys returns the keys of the values produced by a function with the
+// given results, ordered by their string representation.
+func resultKeys(rl resultList) []key {
+	seen := make(map[key]struct{})
+	var keys []key
+	for _, r := range rl.DotResult() {
+		k := key{t: r.Type, name: r.Name, group: r.Group}
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+	return keys
+}
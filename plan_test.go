@@ -0,0 +1,180 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	type (
+		Config  struct{}
+		DB      struct{}
+		Logger  struct{}
+		Server  struct{}
+		Handler struct{}
+		Cache   struct{}
+	)
+
+	// describe summarizes the steps of a plan by the values of each step.
+	describe := func(p Plan) []string {
+		var steps []string
+		for _, s := range p.Steps {
+			desc := fmt.Sprint(s.Keys)
+			if s.Decorator {
+				desc += " decorator"
+			}
+			if s.Built {
+				desc += " built"
+			}
+			steps = append(steps, desc)
+		}
+		return steps
+	}
+
+	t.Run("order", func(t *testing.T) {
+		var called bool
+		c := New()
+		require.NoError(t, c.Provide(func(*DB, *Logger) *Server {
+			called = true
+			return &Server{}
+		}), "provide failed")
+		require.NoError(t, c.Provide(func() *Logger { return &Logger{} }), "provide failed")
+		require.NoError(t, c.Provide(func(*Config) *DB { return &DB{} }), "provide failed")
+		require.NoError(t, c.Provide(func() *Config { return &Config{} }), "provide failed")
+		require.NoError(t, c.Decorate(func(db *DB, _ *Logger) *DB { return db }), "decorate failed")
+
+		p, err := c.Plan(func(*Server) {})
+		require.NoError(t, err, "plan failed")
+		assert.Equal(t, []string{
+			"[*dig.Config]",
+			"[*dig.DB]",
+			"[*dig.Logger]",
+			"[*dig.DB] decorator",
+			"[*dig.Server]",
+		}, describe(p))
+		assert.Empty(t, p.Missing)
+		assert.False(t, called, "constructors must not be called")
+
+		p, err = c.Plan(func(*Logger) {})
+		require.NoError(t, err, "plan failed")
+		assert.Equal(t, []string{"[*dig.Logger]"}, describe(p),
+			"only the dependencies of the function must be planned")
+	})
+
+	t.Run("built values", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *Config { return &Config{} }), "provide failed")
+		require.NoError(t, c.Provide(func(*Config) *DB { return &DB{} }), "provide failed")
+		require.NoError(t, c.Invoke(func(*Config) {}), "invoke failed")
+
+		p, err := c.Plan(func(*DB) {})
+		require.NoError(t, err, "plan failed")
+		assert.Equal(t, []string{"[*dig.Config] built", "[*dig.DB]"}, describe(p))
+	})
+
+	t.Run("missing dependencies", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func(*Cache, *Config) *DB { return &DB{} }), "provide failed")
+
+		p, err := c.Plan(func(struct {
+			In
+
+			DB     *DB
+			Logger *Logger `optional:"true"`
+			Server *Server
+		}) {
+		})
+		require.NoError(t, err, "plan failed")
+		assert.Equal(t, []string{"[*dig.DB]"}, describe(p))
+		assert.Equal(t, []Key{
+			{Type: reflect.TypeOf(&Cache{})},
+			{Type: reflect.TypeOf(&Config{})},
+			{Type: reflect.TypeOf(&Server{})},
+		}, p.Missing)
+	})
+
+	t.Run("value groups", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *Logger { return &Logger{} }), "provide failed")
+		require.NoError(t, c.Provide(func() *Config { return &Config{} }), "provide failed")
+		require.NoError(t, c.Provide(func(*Config) *Handler { return &Handler{} }, Group("handlers")), "provide failed")
+		require.NoError(t, c.Decorate(func(h *Handler, _ *Logger) *Handler { return h }, Group("handlers")), "decorate failed")
+
+		p, err := c.Plan(func(struct {
+			In
+
+			Handlers []*Handler `group:"handlers"`
+		}) {
+		})
+		require.NoError(t, err, "plan failed")
+		assert.Equal(t, []string{
+			"[*dig.Config]",
+			"[*dig.Handler[group=\"handlers\"]]",
+			"[*dig.Logger]",
+			"[*dig.Handler[group=\"handlers\"]] decorator",
+		}, describe(p))
+	})
+
+	t.Run("child containers", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *Config { return &Config{} }), "provide failed")
+		child := c.Child("child")
+		require.NoError(t, child.Provide(func(*Config) *DB { return &DB{} }), "provide failed")
+
+		p, err := child.Plan(func(*DB) {})
+		require.NoError(t, err, "plan failed")
+		require.Len(t, p.Steps, 2)
+		assert.Equal(t, "root", p.Steps[0].Container)
+		assert.Equal(t, "root/child", p.Steps[1].Container)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *Config { return &Config{} }), "provide failed")
+		require.NoError(t, c.Provide(func(*Config, *Cache) *DB { return &DB{} }), "provide failed")
+		require.NoError(t, c.Decorate(func(db *DB) *DB { return db }), "decorate failed")
+		require.NoError(t, c.Invoke(func(*Config) {}), "invoke failed")
+
+		p, err := c.Plan(func(*DB) {})
+		require.NoError(t, err, "plan failed")
+		assertErrorMatches(t, errors.New(p.String()),
+			`"go.uber.org/dig".TestPlan\S+ \(\S+\) in container "root" \(built\)`,
+			`"go.uber.org/dig".TestPlan\S+ \(\S+\) in container "root"`,
+			`"go.uber.org/dig".TestPlan\S+ \(\S+\) in container "root" \(decorator\)`,
+			`missing \*dig.Cache`,
+		)
+	})
+
+	t.Run("invalid functions", func(t *testing.T) {
+		_, err := New().Plan(nil)
+		assert.EqualError(t, err, "can't plan an untyped nil")
+
+		_, err = New().Plan(42)
+		assert.EqualError(t, err, "can't plan non-function 42 (type int)")
+	})
+}
@@ -24,6 +24,8 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 
 	"go.uber.org/dig/internal/dot"
 )
@@ -83,7 +85,11 @@ func newResult(t reflect.Type, opts resultOptions) (result, error) {
 			"cannot return a pointer to a result object, use a value instead: "+
 				"%v is a pointer to a struct that embeds dig.Out", t)
 	case len(opts.Group) > 0:
-		return resultGrouped{Type: t, Group: opts.Group}, nil
+		g, err := parseGroupString(opts.Group)
+		if err != nil {
+			return nil, errWrapf(err, "cannot parse group %q", opts.Group)
+		}
+		return newResultGroupedType(t, g, opts.As)
 	default:
 		return newResultSingle(t, opts)
 	}
@@ -119,6 +125,21 @@ type resultVisitor interface {
 	AnnotateWithPosition(idx int) resultVisitor
 }
 
+// resultVisitorFunc is a resultVisitor that visits each result in a result
+// tree with the return value deciding whether the descendants of that result
+// should be recursed into.
+type resultVisitorFunc func(result) (recurse bool)
+
+func (f resultVisitorFunc) Visit(r result) resultVisitor {
+	if f(r) {
+		return f
+	}
+	return nil
+}
+
+func (f resultVisitorFunc) AnnotateWithField(resultObjectField) resultVisitor { return f }
+func (f resultVisitorFunc) AnnotateWithPosition(int) resultVisitor            { return f }
+
 // walkResult walks the result tree for the given result with the provided
 // visitor.
 //
@@ -251,10 +272,19 @@ func newResultSingle(t reflect.Type, opts resultOptions) (resultSingle, error) {
 		Name: opts.Name,
 	}
 
-	for _, as := range opts.As {
+	var err error
+	r.As, err = newAsTypes(t, opts.As)
+	return r, err
+}
+
+// newAsTypes returns the interfaces specified with dig.As which a value of
+// type t will be made available as, in addition to its own type.
+func newAsTypes(t reflect.Type, as []interface{}) ([]reflect.Type, error) {
+	var types []reflect.Type
+	for _, as := range as {
 		ifaceType := reflect.TypeOf(as).Elem()
 		if !t.Implements(ifaceType) {
-			return r, fmt.Errorf("invalid dig.As: %v does not implement %v", t, ifaceType)
+			return nil, fmt.Errorf("invalid dig.As: %v does not implement %v", t, ifaceType)
 		}
 		if ifaceType == t {
 			// Special case:
@@ -262,10 +292,9 @@ func newResultSingle(t reflect.Type, opts resultOptions) (resultSingle, error) {
 			// Ignore instead of erroring out.
 			continue
 		}
-		r.As = append(r.As, ifaceType)
+		types = append(types, ifaceType)
 	}
-
-	return r, nil
+	return types, nil
 }
 
 func (rs resultSingle) DotResult() []*dot.Result {
@@ -412,36 +441,168 @@ type resultGrouped struct {
 
 	// Type of value produced.
 	Type reflect.Type
+
+	// Indicates whether the value is a slice whose elements should each be
+	// added to the group individually, as specified by the `flatten` option
+	// on the `group:".."` tag.
+	//
+	// If set, Type is the element type of the slice.
+	Flatten bool
+
+	// Key under which the value is added to the group, as specified by the
+	// `key=..` option on the `group:".."` tag. Keyed values may be consumed
+	// as a map[string]T.
+	Key string
+
+	// If specified, this is a list of types which the value will be added to
+	// the group as, in addition to its own type.
+	As []reflect.Type
 }
 
 func (rt resultGrouped) DotResult() []*dot.Result {
-	return []*dot.Result{
-		{
-			Node: &dot.Node{
-				Type:  rt.Type,
-				Group: rt.Group,
-			},
+	dotResults := make([]*dot.Result, 0, len(rt.As)+1)
+	dotResults = append(dotResults, &dot.Result{
+		Node: &dot.Node{
+			Type:  rt.Type,
+			Group: rt.Group,
 		},
+	})
+
+	for _, asType := range rt.As {
+		dotResults = append(dotResults, &dot.Result{
+			Node: &dot.Node{Type: asType, Group: rt.Group},
+		})
 	}
+
+	return dotResults
+}
+
+// Types returns the type of the value and all the types specified with
+// dig.As. The value is added to the group under each of these types.
+func (rt resultGrouped) Types() []reflect.Type {
+	return append([]reflect.Type{rt.Type}, rt.As...)
+}
+
+// groupOptions holds the information parsed from a `group:".."` tag or a
+// dig.Group option.
+type groupOptions struct {
+	Name    string
+	Flatten bool
+	Key     string
+	Soft    bool
+
+	// Min and Max bound the number of values in the group. Max is zero if
+	// the group is unbounded.
+	Min, Max int
+}
+
+// parseGroupString parses a group string of the form "name,option,...".
+//
+// The following options are supported,
+//
+//   flatten  The value is a slice and each of its elements is added to the
+//            group individually.
+//   key=..   The value is added to the group under the given key.
+//   soft     Only values whose constructors were already called are
+//            consumed from the group.
+//   min=N    The group must have at least N values when it is consumed.
+//   max=N    The group must have at most N values when it is consumed.
+func parseGroupString(s string) (groupOptions, error) {
+	components := strings.Split(s, ",")
+	g := groupOptions{Name: components[0]}
+	for _, c := range components[1:] {
+		switch {
+		case c == "flatten":
+			g.Flatten = true
+		case c == "soft":
+			g.Soft = true
+		case strings.HasPrefix(c, "key="):
+			g.Key = strings.TrimPrefix(c, "key=")
+			if len(g.Key) == 0 {
+				return g, errors.New("key cannot be empty")
+			}
+		case strings.HasPrefix(c, "min="):
+			n, err := strconv.Atoi(strings.TrimPrefix(c, "min="))
+			if err != nil || n < 0 {
+				return g, fmt.Errorf("invalid option %q: min must be a non-negative integer", c)
+			}
+			g.Min = n
+		case strings.HasPrefix(c, "max="):
+			n, err := strconv.Atoi(strings.TrimPrefix(c, "max="))
+			if err != nil || n < 1 {
+				return g, fmt.Errorf("invalid option %q: max must be a positive integer", c)
+			}
+			g.Max = n
+		default:
+			return g, fmt.Errorf("invalid option %q", c)
+		}
+	}
+	if g.Max > 0 && g.Min > g.Max {
+		return g, fmt.Errorf("min (%d) cannot be greater than max (%d)", g.Min, g.Max)
+	}
+	return g, nil
 }
 
 // newResultGrouped(f) builds a new resultGrouped from the provided field.
 func newResultGrouped(f reflect.StructField) (resultGrouped, error) {
-	rg := resultGrouped{Group: f.Tag.Get(_groupTag), Type: f.Type}
+	g, err := parseGroupString(f.Tag.Get(_groupTag))
+	if err != nil {
+		return resultGrouped{}, errWrapf(err, "cannot parse group %q", f.Tag.Get(_groupTag))
+	}
 
 	name := f.Tag.Get(_nameTag)
 	optional, _ := isFieldOptional(f)
 	switch {
 	case name != "":
-		return rg, fmt.Errorf(
-			"cannot use named values with value groups: name:%q provided with group:%q", name, rg.Group)
+		return resultGrouped{}, fmt.Errorf(
+			"cannot use named values with value groups: name:%q provided with group:%q", name, g.Name)
 	case optional:
-		return rg, errors.New("value groups cannot be optional")
+		return resultGrouped{}, errors.New("value groups cannot be optional")
 	}
 
-	return rg, nil
+	return newResultGroupedType(f.Type, g, nil /* as */)
+}
+
+// newResultGroupedType builds a resultGrouped for a value of type t that is
+// added to the group described by g, and as each of the interfaces in as.
+func newResultGroupedType(t reflect.Type, g groupOptions, as []interface{}) (resultGrouped, error) {
+	rg := resultGrouped{Group: g.Name, Type: t, Flatten: g.Flatten, Key: g.Key}
+	if g.Soft {
+		return rg, fmt.Errorf(
+			"cannot use soft with result value groups: soft was used with group %q", g.Name)
+	}
+	if g.Min > 0 || g.Max > 0 {
+		return rg, fmt.Errorf(
+			"cannot use min or max with result value groups: min or max was used with group %q", g.Name)
+	}
+	if g.Flatten {
+		if len(g.Key) > 0 {
+			return rg, fmt.Errorf(
+				"cannot use key with flatten: each element of %v would use the same key %q", t, g.Key)
+		}
+		if t.Kind() != reflect.Slice {
+			return rg, fmt.Errorf(
+				"flatten can be applied to slices only: %v is not a slice", t)
+		}
+		rg.Type = t.Elem()
+	}
+
+	var err error
+	rg.As, err = newAsTypes(rg.Type, as)
+	return rg, err
 }
 
 func (rt resultGrouped) Extract(cw containerWriter, v reflect.Value) {
-	cw.submitGroupedValue(rt.Group, rt.Type, v)
+	for _, t := range rt.Types() {
+		switch {
+		case len(rt.Key) > 0:
+			cw.submitKeyedGroupedValue(rt.Group, rt.Key, t, v)
+		case rt.Flatten:
+			for i := 0; i < v.Len(); i++ {
+				cw.submitGroupedValue(rt.Group, t, v.Index(i))
+			}
+		default:
+			cw.submitGroupedValue(rt.Group, t, v)
+		}
+	}
 }
@@ -182,6 +182,36 @@ func TestNewResultObject(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "flattened group tag",
+			give: struct {
+				Out
+
+				Writers []io.Writer `group:"writers,flatten"`
+			}{},
+			wantFields: []resultObjectField{
+				{
+					FieldName:  "Writers",
+					FieldIndex: 1,
+					Result:     resultGrouped{Group: "writers", Type: typeOfWriter, Flatten: true},
+				},
+			},
+		},
+		{
+			desc: "keyed group tag",
+			give: struct {
+				Out
+
+				Writer io.Writer `group:"writers,key=stdout"`
+			}{},
+			wantFields: []resultObjectField{
+				{
+					FieldName:  "Writer",
+					FieldIndex: 1,
+					Result:     resultGrouped{Group: "writers", Type: typeOfWriter, Key: "stdout"},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -247,6 +277,43 @@ func TestNewResultObjectErrors(t *testing.T) {
 			}{},
 			err: "value groups cannot be optional",
 		},
+		{
+			desc: "flatten on a non-slice",
+			give: struct {
+				Out
+
+				Foo string `group:"foo,flatten"`
+			}{},
+			err: `bad field "Foo" of struct { dig.Out; Foo string "group:\"foo,flatten\"" }: ` +
+				"flatten can be applied to slices only: string is not a slice",
+		},
+		{
+			desc: "unknown group option",
+			give: struct {
+				Out
+
+				Foo []string `group:"foo,unknown"`
+			}{},
+			err: `cannot parse group "foo,unknown": invalid option "unknown"`,
+		},
+		{
+			desc: "empty key",
+			give: struct {
+				Out
+
+				Foo string `group:"foo,key="`
+			}{},
+			err: `cannot parse group "foo,key=": key cannot be empty`,
+		},
+		{
+			desc: "min on a result",
+			give: struct {
+				Out
+
+				Foo string `group:"foo,min=1"`
+			}{},
+			err: "cannot use min or max with result value groups: min or max was used with group \"foo\"",
+		},
 		{
 			desc: "name option",
 			give: struct {
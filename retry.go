@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"errors"
+	"reflect"
+	"time"
+)
+
+// RetryPolicy describes how a constructor which returns an error is retried.
+// See Retry.
+type RetryPolicy struct {
+	// Maximum number of times the constructor is called, including the
+	// first call. It must be at least 1.
+	Attempts int
+
+	// Backoff returns how long to wait before the given retry, starting at 1
+	// for the second call of the constructor. Retries are immediate if
+	// Backoff is nil.
+	Backoff func(retry int) time.Duration
+
+	// Retryable reports whether the constructor may be called again after
+	// it failed with the given error. If Retryable is nil, all errors are
+	// retried except timeouts: a constructor which timed out may still be
+	// running, and is only retried if Retryable accepts errors for which
+	// IsTimeout is true. It is then called again once the call which timed
+	// out returned, so it should stop when its context.Context is
+	// cancelled.
+	Retryable func(error) bool
+}
+
+// Retry is a ProvideOption which calls the constructor again if it returns an
+// error, as described by the given policy. Values produced by failed calls
+// are discarded, panics are never retried, and timeouts are only retried if
+// the policy allows it explicitly.
+//
+//   c.Provide(NewSidecarClient, dig.Retry(dig.RetryPolicy{
+//     Attempts: 5,
+//     Backoff: func(retry int) time.Duration {
+//       return time.Duration(retry) * 100 * time.Millisecond
+//     },
+//     Retryable: isUnavailable,
+//   }))
+//
+// Errors of constructors which were called more than once report the number
+// of attempts, as does VisualizeError. Retry cannot be used with Decorate.
+func Retry(p RetryPolicy) ProvideOption {
+	return provideOptionFunc(func(opts *provideOptions) {
+		opts.Retry = &p
+	})
+}
+
+func (p *RetryPolicy) validate() error {
+	if p.Attempts < 1 {
+		return errors.New("invalid dig.Retry: at least one attempt is required")
+	}
+	return nil
+}
+
+// retryable reports whether a constructor which failed with the given error
+// may be called again.
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	_, timedOut := err.(errTimedOut)
+	return !timedOut
+}
+
+// callWithRetries calls the constructor of n with the given arguments,
+// retrying as described by its retry policy. It returns the values produced
+// by the successful call and the time spent in the constructor.
+func (n *node) callWithRetries(c containerStore, args []reflect.Value) (*stagingContainerWriter, time.Duration, error) {
+	var total time.Duration
+	for attempt := 1; ; attempt++ {
+		receiver := newStagingContainerWriter()
+		d, err := n.callConstructor(c, args, receiver)
+		total += d
+		if err == nil {
+			return receiver, total, nil
+		}
+		if _, ok := err.(PanicError); ok {
+			return nil, total, err
+		}
+
+		p := n.retry
+		if p == nil || attempt >= p.Attempts || !p.retryable(err) {
+			if attempt > 1 {
+				err = errRetriesExhausted{CtorID: n.ID(), Attempts: attempt, Reason: err}
+			}
+			return nil, total, err
+		}
+		if p.Backoff != nil {
+			time.Sleep(p.Backoff(attempt))
+		}
+		if _, ok := err.(errTimedOut); ok {
+			n.awaitAbandoned(c)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	type Client struct{}
+
+	// flaky returns a constructor which fails the given number of times.
+	flaky := func(failures int) (ctor func() (*Client, error), calls *int) {
+		calls = new(int)
+		return func() (*Client, error) {
+			*calls++
+			if *calls <= failures {
+				return nil, errors.New("great sadness")
+			}
+			return &Client{}, nil
+		}, calls
+	}
+
+	t.Run("succeeds after retries", func(t *testing.T) {
+		var retries []int
+		ctor, calls := flaky(2)
+
+		c := New()
+		require.NoError(t, c.Provide(ctor, Retry(RetryPolicy{
+			Attempts: 3,
+			Backoff: func(retry int) time.Duration {
+				retries = append(retries, retry)
+				return time.Millisecond
+			},
+		})), "provide failed")
+
+		require.NoError(t, c.Invoke(func(*Client) {}), "invoke failed")
+		assert.Equal(t, 3, *calls)
+		assert.Equal(t, []int{1, 2}, retries)
+	})
+
+	t.Run("attempts are exhausted", func(t *testing.T) {
+		ctor, calls := flaky(5)
+
+		c := New()
+		require.NoError(t, c.Provide(ctor, Retry(RetryPolicy{Attempts: 3})), "provide failed")
+
+		err := c.Invoke(func(*Client) {})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".TestRetry\S+`,
+			`failed to build \*dig.Client:`,
+			`function "go.uber.org/dig".TestRetry\S+ \(\S+\) returned a non-nil error:`,
+			`failed after 3 attempts: great sadness`,
+		)
+		assert.Equal(t, "great sadness", RootCause(err).Error())
+		assert.Equal(t, 3, *calls)
+
+		var b bytes.Buffer
+		require.NoError(t, Visualize(c, &b, VisualizeError(err)))
+		assert.Contains(t, b.String(), `\nfailed after 3 attempts"`)
+	})
+
+	t.Run("errors which may not be retried", func(t *testing.T) {
+		ctor, calls := flaky(5)
+
+		c := New()
+		require.NoError(t, c.Provide(ctor, Retry(RetryPolicy{
+			Attempts:  3,
+			Retryable: func(error) bool { return false },
+		})), "provide failed")
+
+		err := c.Invoke(func(*Client) {})
+		require.Error(t, err, "invoke must fail")
+		assert.NotContains(t, err.Error(), "attempts")
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("panics are not retried", func(t *testing.T) {
+		var calls int
+		c := New(RecoverFromPanics())
+		require.NoError(t, c.Provide(func() *Client {
+			calls++
+			panic("great sadness")
+		}, Retry(RetryPolicy{Attempts: 3})), "provide failed")
+
+		err := c.Invoke(func(*Client) {})
+		require.Error(t, err, "invoke must fail")
+		assert.IsType(t, PanicError{}, RootCause(err))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("timeouts are not retried by default", func(t *testing.T) {
+		started := make(chan struct{}, 3)
+		unblock := make(chan struct{})
+		defer close(unblock)
+
+		c := New()
+		require.NoError(t, c.Provide(func() *Client {
+			started <- struct{}{}
+			<-unblock
+			return &Client{}
+		}, Timeout(10*time.Millisecond), Retry(RetryPolicy{Attempts: 3})), "provide failed")
+
+		err := c.Invoke(func(*Client) {})
+		require.Error(t, err, "invoke must fail")
+		assert.True(t, IsTimeout(err), "expected a timeout error")
+		assert.NotContains(t, err.Error(), "attempts")
+		assert.Len(t, started, 1)
+	})
+
+	t.Run("timeouts are retried if retryable", func(t *testing.T) {
+		var calls int32
+
+		c := New()
+		require.NoError(t, c.Provide(context.Background), "provide failed")
+		require.NoError(t, c.Provide(func(ctx context.Context) (*Client, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				return nil, ctx.Err()
+			}
+			return &Client{}, nil
+		}, Timeout(10*time.Millisecond), Retry(RetryPolicy{
+			Attempts:  2,
+			Retryable: IsTimeout,
+		})), "provide failed")
+
+		// The constructor isn't called again until its first call returned,
+		// so the second attempt doesn't fail because the first is running.
+		require.NoError(t, c.Invoke(func(*Client) {}), "invoke failed")
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("request scopes", func(t *testing.T) {
+		ctor, calls := flaky(1)
+
+		scopes := New().RequestScopes()
+		require.NoError(t, scopes.Provide(ctor, Retry(RetryPolicy{Attempts: 2})), "provide failed")
+		s, err := scopes.New()
+		require.NoError(t, err, "new failed")
+
+		require.NoError(t, s.Invoke(func(*Client) {}), "invoke failed")
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("invalid policies", func(t *testing.T) {
+		c := New()
+
+		err := c.Provide(func() *Client { return nil }, Retry(RetryPolicy{}))
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(), "invalid dig.Retry: at least one attempt is required")
+
+		require.NoError(t, c.Provide(func() *Client { return nil }), "provide failed")
+		err = c.Decorate(func(c *Client) *Client { return c }, Retry(RetryPolicy{Attempts: 2}))
+		require.Error(t, err, "decorate must fail")
+		assert.Contains(t, err.Error(), "cannot use dig.Retry with decorators")
+	})
+}
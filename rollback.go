@@ -0,0 +1,91 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+// RollbackOnFailure is an InvokeOption which undoes the changes made to the
+// container if Invoke fails. The values built while Invoke ran are removed
+// from the container and its relatives, including the values added to value
+// groups, and their constructors and decorators will be called again by a
+// later Invoke.
+//
+//   err := c.Invoke(func(s *Server) error {
+//     return s.Start()
+//   }, dig.RollbackOnFailure())
+//
+// The changes are undone whether the function could not be called because
+// one of its dependencies failed to build, or the function returned an
+// error itself. If Invoke is called recursively from an invoked function,
+// only the changes made by the failed Invoke are undone.
+//
+// Values built concurrently by other goroutines cannot be distinguished from
+// the values built by Invoke, so containers must not be shared by goroutines
+// during a transactional Invoke. For the same reason, Invoke fails with this
+// option once request scopes were created from the tree of containers, and
+// RequestScope.Invoke ignores it.
+func RollbackOnFailure() InvokeOption {
+	return invokeOptionFunc(func(opts *invokeOptions) {
+		opts.RollbackOnFailure = true
+	})
+}
+
+// journal records how to undo the changes made to a tree of containers.
+type journal struct {
+	undo []func()
+}
+
+// record adds a function which undoes a change to the journal.
+func (j *journal) record(undo func()) {
+	j.undo = append(j.undo, undo)
+}
+
+// journal returns the journal of the tree of containers this container
+// belongs to if a transactional Invoke is in progress, and nil otherwise.
+func (c *Container) journal() *journal {
+	if c == nil {
+		return nil
+	}
+	return c.getRoot().invokeJournal
+}
+
+// beginTransaction starts recording the changes made to the tree of
+// containers this container belongs to. It returns a function which undoes
+// them if the given error is non-nil.
+func (c *Container) beginTransaction() func(*error) {
+	root := c.getRoot()
+	outermost := root.invokeJournal == nil
+	if outermost {
+		root.invokeJournal = new(journal)
+	}
+	j := root.invokeJournal
+	savepoint := len(j.undo)
+
+	return func(err *error) {
+		if *err != nil {
+			for i := len(j.undo) - 1; i >= savepoint; i-- {
+				j.undo[i]()
+			}
+			j.undo = j.undo[:savepoint]
+		}
+		if outermost {
+			root.invokeJournal = nil
+		}
+	}
+}
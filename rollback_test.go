@@ -0,0 +1,167 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackOnFailure(t *testing.T) {
+	type A struct{}
+	type B struct{}
+	type in struct {
+		In
+
+		Values []string          `group:"values"`
+		Keyed  map[string]string `group:"keyed"`
+		A      *A
+		B      *B
+	}
+	type out struct {
+		Out
+
+		Value string `group:"values"`
+		Keyed string `group:"keyed,key=k"`
+	}
+
+	stringType := reflect.TypeOf("")
+
+	// setup provides constructors of A and of the value groups which count
+	// their calls, and a constructor of B which fails until it's fixed.
+	setup := func(t *testing.T, c *Container) (calls map[string]int, fix func()) {
+		calls = make(map[string]int)
+		fail := true
+		require.NoError(t, c.Provide(func() *A {
+			calls["A"]++
+			return &A{}
+		}), "provide failed")
+		require.NoError(t, c.Provide(func() out {
+			calls["out"]++
+			return out{Value: "v", Keyed: "k"}
+		}), "provide failed")
+		require.NoError(t, c.Provide(func() (*B, error) {
+			calls["B"]++
+			if fail {
+				return nil, errors.New("great sadness")
+			}
+			return &B{}, nil
+		}), "provide failed")
+		return calls, func() { fail = false }
+	}
+
+	t.Run("dependency failure", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+		calls, fix := setup(t, c)
+
+		err := child.Invoke(func(in) {}, RollbackOnFailure())
+		require.Error(t, err, "invoke must fail")
+		assert.Equal(t, "great sadness", RootCause(err).Error())
+		assert.Empty(t, c.values, "values must be removed")
+		assert.Empty(t, c.groups[key{group: "values", t: stringType}], "value groups must be emptied")
+		assert.Empty(t, c.keyedGroups[key{group: "keyed", t: stringType}], "keyed value groups must be emptied")
+
+		fix()
+		require.NoError(t, child.Invoke(func(i in) {
+			assert.Equal(t, []string{"v"}, i.Values)
+			assert.Equal(t, map[string]string{"k": "k"}, i.Keyed)
+		}, RollbackOnFailure()), "invoke failed")
+		assert.Equal(t, map[string]int{"A": 2, "out": 2, "B": 2}, calls,
+			"constructors must be called again after a rollback")
+	})
+
+	t.Run("without the option", func(t *testing.T) {
+		c := New()
+		calls, fix := setup(t, c)
+
+		require.Error(t, c.Invoke(func(in) {}), "invoke must fail")
+		fix()
+		require.NoError(t, c.Invoke(func(in) {}), "invoke failed")
+		assert.Equal(t, 1, calls["A"], "values must be kept")
+	})
+
+	t.Run("function failure", func(t *testing.T) {
+		c := New()
+		calls, fix := setup(t, c)
+		fix()
+
+		err := c.Invoke(func(*A) error {
+			return errors.New("great sadness")
+		}, RollbackOnFailure())
+		require.Error(t, err, "invoke must fail")
+		assert.Empty(t, c.values, "values must be removed")
+
+		require.NoError(t, c.Invoke(func(*A) {}), "invoke failed")
+		assert.Equal(t, 2, calls["A"])
+	})
+
+	t.Run("decorated values are restored", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+		require.NoError(t, c.Provide(func() string { return "v" }), "provide failed")
+		require.NoError(t, c.Invoke(func(string) {}), "invoke failed")
+
+		var decorations int
+		require.NoError(t, c.Decorate(func(s string) string {
+			decorations++
+			return s + "!"
+		}), "decorate failed")
+		require.NoError(t, child.Provide(func() (*B, error) {
+			return nil, errors.New("great sadness")
+		}), "provide failed")
+
+		require.Error(t, child.Invoke(func(string, *B) {}, RollbackOnFailure()), "invoke must fail")
+		v, _ := c.getValue("", stringType)
+		assert.Equal(t, "v", v.String(), "the undecorated value must be restored")
+
+		require.NoError(t, c.Invoke(func(s string) {
+			assert.Equal(t, "v!", s)
+		}), "invoke failed")
+		assert.Equal(t, 2, decorations)
+	})
+
+	t.Run("nested invokes", func(t *testing.T) {
+		c := New()
+		calls, _ := setup(t, c)
+
+		require.NoError(t, c.Invoke(func(*A) {
+			err := c.Invoke(func(out struct {
+				In
+
+				Values []string `group:"values"`
+				B      *B
+			}) {
+			}, RollbackOnFailure())
+			assert.Error(t, err, "nested invoke must fail")
+		}, RollbackOnFailure()), "invoke failed")
+
+		assert.Equal(t, map[string]int{"A": 1, "out": 1, "B": 1}, calls)
+		_, ok := c.getValue("", reflect.TypeOf(&A{}))
+		assert.True(t, ok, "values built by the outer invoke must be kept")
+		assert.Empty(t, c.groups[key{group: "values", t: stringType}],
+			"values built by the failed nested invoke must be removed")
+	})
+}
@@ -0,0 +1,526 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/dig/internal/digreflect"
+	"go.uber.org/dig/internal/dot"
+)
+
+// RequestScopes holds the request-scoped constructors of a container and
+// creates RequestScopes from them.
+//
+// Request-scoped constructors are called at most once per RequestScope.
+// Everything else is resolved from the parent container, which is frozen
+// when the first RequestScope is created: the parent and its ancestors may no
+// longer be used to Provide or Decorate, nor may their children be detached.
+// They may still be used to Invoke, and children created afterwards may
+// provide their own values.
+//
+// The values of the parent are built the first time they are needed, by a
+// scope or by Invoke, and are shared by all the scopes. The containers of the
+// tree are locked while those values are built, so the constructors and
+// decorators of the parent and its ancestors must not call Invoke on the
+// containers of the tree or create request scopes.
+//
+//   scopes := c.RequestScopes()
+//   err := scopes.Provide(func(r *http.Request, log *zap.Logger) *Session {
+//     ...
+//   })
+//
+//   func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+//     scope, err := h.scopes.New(r)
+//     ...
+//     err = scope.Invoke(func(s *Session) { ... })
+//   }
+//
+// RequestScopes is safe for concurrent use once all request-scoped
+// constructors were provided, as are the RequestScopes it creates with the
+// Invoke method of the containers of the tree. Other methods of the
+// containers must not be called concurrently with them.
+type RequestScopes struct {
+	parent *Container
+
+	// Request-scoped constructors, indexed by the keys they provide.
+	providers map[key]*node
+
+	// Guards providers and frozen.
+	mu     sync.Mutex
+	frozen bool
+
+	once sync.Once
+	err  error // error freezing the parent, if any
+}
+
+// RequestScopes returns a new RequestScopes whose scopes fall through to this
+// container.
+func (c *Container) RequestScopes() *RequestScopes {
+	return &RequestScopes{
+		parent:    c,
+		providers: make(map[key]*node),
+	}
+}
+
+// Provide registers a request-scoped constructor. Its dependencies are
+// resolved from the RequestScope it is called in, and its results are
+// private to that scope.
+//
+// The dig.Name and dig.As options are supported. Request-scoped constructors
+// cannot add values to value groups. Types provided to the parent container
+// may be replaced in the scopes with the Override option.
+//
+// Request-scoped constructors must be provided before the first RequestScope
+// is created.
+func (rs *RequestScopes) Provide(constructor interface{}, opts ...ProvideOption) error {
+	ctype := reflect.TypeOf(constructor)
+	if ctype == nil {
+		return errors.New("can't provide an untyped nil")
+	}
+	if ctype.Kind() != reflect.Func {
+		return fmt.Errorf("must provide constructor function, got %v (type %v)", constructor, ctype)
+	}
+
+	var options provideOptions
+	for _, o := range opts {
+		o.applyProvideOption(&options)
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	options.Location = inspectCall(constructor, options.CallerSkip)
+	options.ID = rs.parent.newNodeID()
+
+	if err := rs.provide(constructor, options); err != nil {
+		return errProvide{
+			Func:   options.Location,
+			Path:   rs.parent.childPath(),
+			Reason: err,
+		}
+	}
+	return nil
+}
+
+func (rs *RequestScopes) provide(ctor interface{}, opts provideOptions) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.frozen {
+		return errors.New("request-scoped constructors must be provided before the first request scope is created")
+	}
+	switch {
+	case len(opts.Group) > 0:
+		return errors.New("cannot use dig.Group with request-scoped constructors")
+	case opts.Export:
+		return errors.New("cannot use dig.Export with request-scoped constructors")
+	case opts.Priority != 0:
+		return errors.New("cannot use dig.Priority with constructors")
+	}
+
+	n, err := newNode(ctor, nodeOptions{
+		ResultName: opts.Name,
+		ResultAs:   opts.As,
+		Location:   opts.Location,
+		ID:         opts.ID,
+	})
+	if err != nil {
+		return err
+	}
+	n.container, n.providedTo = rs.parent, rs.parent
+	n.override = opts.Override
+	n.retry = opts.Retry
+	n.timeout = opts.Timeout
+
+	keys, err := rs.findAndValidateResults(n)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%v must provide at least one non-error type", reflect.TypeOf(ctor))
+	}
+
+	for _, k := range keys {
+		rs.providers[k] = n
+	}
+	store := &RequestScope{scopes: rs}
+	for _, k := range keys {
+		if err := verifyAcyclic(store, scopedNode{node: n, s: store}, k); err != nil {
+			for _, k := range keys {
+				delete(rs.providers, k)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// findAndValidateResults returns the keys produced by a request-scoped
+// constructor, verifying that they don't conflict with the other
+// constructors of the scopes or, unless n overrides them, of the parent.
+func (rs *RequestScopes) findAndValidateResults(n *node) ([]key, error) {
+	var (
+		keys []key
+		err  error
+	)
+	seen := make(map[key]struct{})
+	walkResult(n.ResultList(), resultVisitorFunc(func(res result) bool {
+		if err != nil {
+			return false
+		}
+
+		switch r := res.(type) {
+		case resultSingle:
+			for _, t := range append([]reflect.Type{r.Type}, r.As...) {
+				k := key{name: r.Name, t: t}
+				if _, ok := seen[k]; ok {
+					err = fmt.Errorf("cannot provide %v: provided more than once", k)
+					return false
+				}
+				if err = rs.checkKey(n, k); err != nil {
+					return false
+				}
+				seen[k] = struct{}{}
+				keys = append(keys, k)
+			}
+		case resultGrouped:
+			err = fmt.Errorf("cannot provide %v: request-scoped constructors cannot add values to value groups",
+				key{group: r.Group, t: r.Type})
+			return false
+		}
+		return true
+	}))
+	return keys, err
+}
+
+func (rs *RequestScopes) checkKey(n *node, k key) error {
+	if other, ok := rs.providers[k]; ok {
+		return fmt.Errorf("cannot provide %v: already provided by %v", k, other.Location())
+	}
+	if n.override {
+		return nil
+	}
+
+	ps := rs.parent.getValueProviders(k.name, k.t)
+	if len(ps) == 0 {
+		return nil
+	}
+	cons := make([]string, len(ps))
+	for i, p := range ps {
+		cons[i] = fmt.Sprint(p.Location()) + inContainer(p.ContainerPath())
+	}
+	return fmt.Errorf("cannot provide %v: already provided by %v", k, strings.Join(cons, "; "))
+}
+
+// New creates a RequestScope. The given values are available only in the
+// new scope, indexed by their types, and take precedence over the
+// request-scoped constructors and the parent container.
+//
+// The first call to New freezes the parent container. If the parent cannot
+// be frozen, the error is returned by this and all later calls to New.
+func (rs *RequestScopes) New(values ...interface{}) (*RequestScope, error) {
+	rs.once.Do(func() {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+
+		rs.frozen = true
+		if err := rs.parent.freeze(); err != nil {
+			rs.err = errWrapf(err, "cannot freeze container %q", rs.parent.Path())
+		}
+	})
+	if rs.err != nil {
+		return nil, rs.err
+	}
+
+	s := &RequestScope{scopes: rs}
+	if len(values) == 0 {
+		return s, nil
+	}
+
+	s.values = make(map[key]reflect.Value, len(values))
+	for _, v := range values {
+		t := reflect.TypeOf(v)
+		if t == nil {
+			return nil, errors.New("cannot add an untyped nil to a request scope")
+		}
+		k := key{t: t}
+		if _, ok := s.values[k]; ok {
+			return nil, fmt.Errorf("cannot add %v to a request scope more than once", t)
+		}
+		s.values[k] = reflect.ValueOf(v)
+	}
+	return s, nil
+}
+
+// freeze makes this container and its ancestors read-only, so that request
+// scopes created from it may build their values on demand. From then on,
+// values are built in the tree of containers with the tree locked.
+func (c *Container) freeze() error {
+	root := c.getRoot()
+	root.sharedMu.Lock()
+	defer root.sharedMu.Unlock()
+
+	if c.frozen {
+		return nil
+	}
+	if c.detached {
+		return fmt.Errorf("container %q was detached", c.Path())
+	}
+	if c.createdSealed {
+		return errSealed{Path: c.Path(), Created: true}
+	}
+	c.markInvoked()
+
+	for p := c; p != nil; p = p.parent {
+		if !p.isVerifiedAcyclic {
+			if err := p.verifyAcyclic(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for p := c; p != nil; p = p.parent {
+		p.frozen = true
+	}
+	atomic.StoreInt32(&root.shared, 1)
+	return nil
+}
+
+// RequestScope resolves request-scoped values. It is created by
+// RequestScopes.New and is cheap to create: its storage is allocated only
+// once a request-scoped value is built.
+//
+// A RequestScope is not safe for concurrent use. Use one RequestScope per
+// goroutine, for example one per request.
+type RequestScope struct {
+	scopes *RequestScopes
+
+	// Values built in or given to this scope.
+	values map[key]reflect.Value
+
+	// Request-scoped constructors which were called in this scope.
+	called map[*node]struct{}
+
+	// Values being built in this scope and request-scoped constructors
+	// which timed out in it.
+	build buildState
+}
+
+var _ containerStore = (*RequestScope)(nil)
+
+// Invoke runs the given function after instantiating its dependencies from
+// the scope, as with Container.Invoke.
+func (s *RequestScope) Invoke(function interface{}, opts ...InvokeOption) (err error) {
+	ftype := reflect.TypeOf(function)
+	if ftype == nil {
+		return errors.New("can't invoke an untyped nil")
+	}
+	if ftype.Kind() != reflect.Func {
+		return fmt.Errorf("can't invoke non-function %v (type %v)", function, ftype)
+	}
+	if o := s.scopes.parent.observer; o != nil {
+		defer observeInvoke(o, function, s.scopes.parent.Path())(&err)
+	}
+
+	pl, err := newParamList(ftype)
+	if err != nil {
+		return err
+	}
+
+	if err := shallowCheckDependencies(s, pl); err != nil {
+		return errMissingDependencies{
+			Func:   digreflect.InspectFunc(function),
+			Reason: err,
+		}
+	}
+	args, err := pl.BuildList(s)
+	if err != nil {
+		return errArgumentsFailed{
+			Func:   digreflect.InspectFunc(function),
+			Reason: err,
+		}
+	}
+
+	return s.scopes.parent.callInvoked(function, args)
+}
+
+func (s *RequestScope) knownTypes() []reflect.Type {
+	types := s.scopes.parent.knownTypes()
+	for k := range s.scopes.providers {
+		types = append(types, k.t)
+	}
+	for k := range s.values {
+		types = append(types, k.t)
+	}
+	sort.Sort(byTypeName(types))
+	return types
+}
+
+// isScoped reports whether the values with the given key are resolved from
+// this scope rather than from its parent: if they were given to New, or if
+// request-scoped constructors provide them.
+func (s *RequestScope) isScoped(k key) bool {
+	if _, ok := s.values[k]; ok {
+		return true
+	}
+	_, ok := s.scopes.providers[k]
+	return ok
+}
+
+// buildInParent builds p from the parent container of this scope, with the
+// tree of containers locked as other scopes may build values in it
+// concurrently.
+func (s *RequestScope) buildInParent(p param) (reflect.Value, error) {
+	defer s.scopes.parent.lockShared()()
+	return p.Build(s.scopes.parent)
+}
+
+func (s *RequestScope) getValue(name string, t reflect.Type) (reflect.Value, bool) {
+	k := key{name: name, t: t}
+	if v, ok := s.values[k]; ok {
+		return v, true
+	}
+	// Request-scoped constructors shadow the parent.
+	if _, ok := s.scopes.providers[k]; ok {
+		return _noValue, false
+	}
+	defer s.scopes.parent.lockShared()()
+	return s.scopes.parent.getValue(name, t)
+}
+
+func (s *RequestScope) setValue(name string, t reflect.Type, v reflect.Value) {
+	if s.values == nil {
+		s.values = make(map[key]reflect.Value)
+	}
+	s.values[key{name: name, t: t}] = v
+}
+
+func (s *RequestScope) getValueGroup(name string, t reflect.Type) ([]reflect.Value, error) {
+	unlock := s.scopes.parent.lockShared()
+	items, err := s.scopes.parent.valueGroup(name, t)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	// The source of randomness of the parent is not safe for concurrent use,
+	// so the values are shuffled with the global one.
+	return shuffledCopy(rand.Perm, items), nil
+}
+
+func (s *RequestScope) getKeyedValueGroup(name string, t reflect.Type) (map[string]reflect.Value, error) {
+	defer s.scopes.parent.lockShared()()
+	return s.scopes.parent.getKeyedValueGroup(name, t)
+}
+
+// Request-scoped constructors cannot produce value groups, so values are
+// never submitted to groups of a RequestScope.
+
+func (s *RequestScope) submitGroupedValue(name string, t reflect.Type, v reflect.Value) {
+	panic("not supposed to happen")
+}
+
+func (s *RequestScope) submitKeyedGroupedValue(name, mapKey string, t reflect.Type, v reflect.Value) {
+	panic("not supposed to happen")
+}
+
+func (s *RequestScope) getValueProviders(name string, t reflect.Type) []provider {
+	k := key{name: name, t: t}
+	if _, ok := s.values[k]; ok {
+		return nil
+	}
+	if n, ok := s.scopes.providers[k]; ok {
+		return []provider{scopedNode{node: n, s: s}}
+	}
+	return s.scopes.parent.getValueProviders(name, t)
+}
+
+func (s *RequestScope) getGroupProviders(name string, t reflect.Type) []provider {
+	return s.scopes.parent.getGroupProviders(name, t)
+}
+
+func (s *RequestScope) getDecorators(k key) []*node {
+	if _, ok := s.values[k]; ok {
+		return nil
+	}
+	if _, ok := s.scopes.providers[k]; ok {
+		return nil
+	}
+	return s.scopes.parent.getDecorators(k)
+}
+
+func (s *RequestScope) getElementDecorators(k key) []*elementDecorator {
+	return s.scopes.parent.getElementDecorators(k)
+}
+
+func (s *RequestScope) createGraph() *dot.Graph {
+	return s.scopes.parent.createGraph()
+}
+
+// scopedNode is a request-scoped constructor bound to a RequestScope. It is
+// called at most once per scope and its values are stored in the scope.
+type scopedNode struct {
+	*node
+
+	s *RequestScope
+}
+
+func (n scopedNode) Scope(containerStore) containerStore { return n.s }
+
+func (n scopedNode) Call(containerStore) error {
+	if _, ok := n.s.called[n.node]; ok {
+		return nil
+	}
+
+	if err := shallowCheckDependencies(n.s, n.paramList); err != nil {
+		return errMissingDependencies{
+			Func:   n.location,
+			Path:   n.ContainerPath(),
+			Reason: err,
+		}
+	}
+	args, err := n.paramList.BuildList(n.s)
+	if err != nil {
+		return errArgumentsFailed{
+			Func:   n.location,
+			Path:   n.ContainerPath(),
+			Reason: err,
+		}
+	}
+
+	receiver, _, err := n.callWithRetries(n.s, args)
+	if err != nil {
+		return errCallFailed(n.location, n.ContainerPath(), err)
+	}
+	receiver.Commit(n.s)
+
+	if n.s.called == nil {
+		n.s.called = make(map[*node]struct{})
+	}
+	n.s.called[n.node] = struct{}{}
+	return nil
+}
@@ -0,0 +1,417 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestScopes(t *testing.T) {
+	type Config struct{ Name string }
+	type Request struct{ ID int }
+	type Session struct {
+		Config  *Config
+		Request *Request
+	}
+
+	t.Run("resolves from the scope and the parent", func(t *testing.T) {
+		c := New()
+
+		var configs, sessions int
+		require.NoError(t, c.Provide(func() *Config {
+			configs++
+			return &Config{Name: "app"}
+		}), "provide failed")
+
+		scopes := c.RequestScopes()
+		require.NoError(t, scopes.Provide(func(cfg *Config, r *Request) *Session {
+			sessions++
+			return &Session{Config: cfg, Request: r}
+		}), "provide failed")
+
+		for i := 1; i <= 2; i++ {
+			s, err := scopes.New(&Request{ID: i})
+			require.NoError(t, err, "new failed")
+
+			var first *Session
+			require.NoError(t, s.Invoke(func(sess *Session) {
+				first = sess
+				assert.Equal(t, "app", sess.Config.Name)
+				assert.Equal(t, i, sess.Request.ID)
+			}), "invoke failed")
+			require.NoError(t, s.Invoke(func(sess *Session) {
+				assert.True(t, first == sess, "session must be built once per scope")
+			}), "invoke failed")
+		}
+
+		assert.Equal(t, 1, configs, "parent values must be built once")
+		assert.Equal(t, 2, sessions, "scoped values must be built once per scope")
+	})
+
+	t.Run("parent is frozen", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+		require.NoError(t, c.Provide(func() *Config { return &Config{} }), "provide failed")
+
+		_, err := c.RequestScopes().New()
+		require.NoError(t, err, "new failed")
+
+		err = c.Provide(func() *Request { return nil })
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(), `container "root" is frozen`)
+
+		err = c.Decorate(func(cfg *Config) *Config { return cfg })
+		require.Error(t, err, "decorate must fail")
+		assert.Contains(t, err.Error(), `container "root" is frozen`)
+
+		err = child.Provide(func() *Request { return nil }, Export(true))
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(), `container "root" is frozen`)
+
+		err = child.Detach()
+		require.Error(t, err, "detach must fail")
+		assert.Contains(t, err.Error(), `container "root" is frozen`)
+
+		err = c.Invoke(func(*Config) {}, RollbackOnFailure())
+		require.Error(t, err, "invoke must fail")
+		assert.Contains(t, err.Error(), "cannot roll back an Invoke on containers used by request scopes")
+
+		assert.NoError(t, c.Invoke(func(*Config) {}), "invoke failed")
+		assert.NoError(t, child.Invoke(func(*Config) {}), "invoke failed")
+
+		later := c.Child("later")
+		require.NoError(t, later.Provide(func(cfg *Config) *Request { return &Request{} }), "provide failed")
+		require.NoError(t, child.Provide(func() *Session { return &Session{} }), "provide failed")
+		assert.NoError(t, later.Invoke(func(*Request) {}), "invoke failed")
+
+		_, err = c.RequestScopes().New()
+		assert.NoError(t, err, "a frozen container may have more request scopes")
+	})
+
+	t.Run("parent values are decorated", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *Config { return &Config{Name: "app"} }), "provide failed")
+		require.NoError(t, c.Decorate(func(cfg *Config) *Config {
+			return &Config{Name: cfg.Name + "!"}
+		}), "decorate failed")
+
+		s, err := c.RequestScopes().New()
+		require.NoError(t, err, "new failed")
+		require.NoError(t, s.Invoke(func(cfg *Config) {
+			assert.Equal(t, "app!", cfg.Name)
+		}), "invoke failed")
+	})
+
+	t.Run("scoped constructors may override the parent", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *Config { return &Config{Name: "parent"} }), "provide failed")
+
+		scopes := c.RequestScopes()
+		err := scopes.Provide(func() *Config { return &Config{Name: "scope"} })
+		require.Error(t, err, "provide must fail without override")
+		assertErrorMatches(t, err,
+			`function "go.uber.org/dig".TestRequestScopes\S+ \(\S+\) cannot be provided:`,
+			`cannot provide \*dig.Config: already provided by "go.uber.org/dig".TestRequestScopes\S+`,
+		)
+
+		require.NoError(t, scopes.Provide(func() *Config {
+			return &Config{Name: "scope"}
+		}, Override(true)), "provide failed")
+
+		s, err := scopes.New()
+		require.NoError(t, err, "new failed")
+		require.NoError(t, s.Invoke(func(cfg *Config) {
+			assert.Equal(t, "scope", cfg.Name)
+		}), "invoke failed")
+	})
+
+	t.Run("invalid scoped constructors", func(t *testing.T) {
+		type out struct {
+			Out
+
+			Config *Config `group:"configs"`
+		}
+
+		scopes := New().RequestScopes()
+		tests := []struct {
+			desc string
+			ctor interface{}
+			opts []ProvideOption
+			err  string
+		}{
+			{
+				desc: "group option",
+				ctor: func() *Config { return nil },
+				opts: []ProvideOption{Group("configs")},
+				err:  "cannot use dig.Group with request-scoped constructors",
+			},
+			{
+				desc: "group result",
+				ctor: func() out { return out{} },
+				err:  "request-scoped constructors cannot add values to value groups",
+			},
+			{
+				desc: "export",
+				ctor: func() *Config { return nil },
+				opts: []ProvideOption{Export(true)},
+				err:  "cannot use dig.Export with request-scoped constructors",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.desc, func(t *testing.T) {
+				err := scopes.Provide(tt.ctor, tt.opts...)
+				require.Error(t, err, "provide must fail")
+				assert.Contains(t, err.Error(), tt.err)
+			})
+		}
+	})
+
+	t.Run("scoped cycles are rejected", func(t *testing.T) {
+		scopes := New().RequestScopes()
+		require.NoError(t, scopes.Provide(func(*Request) *Session { return nil }), "provide failed")
+
+		err := scopes.Provide(func(*Session) *Request { return nil })
+		require.Error(t, err, "provide must fail")
+		assertErrorMatches(t, err,
+			`cannot be provided:`,
+			`this function introduces a cycle:`,
+			`\*dig.Request provided by "go.uber.org/dig".TestRequestScopes\S+`,
+			`depends on \*dig.Session provided by "go.uber.org/dig".TestRequestScopes\S+`,
+		)
+	})
+
+	t.Run("provide after new fails", func(t *testing.T) {
+		scopes := New().RequestScopes()
+		_, err := scopes.New()
+		require.NoError(t, err, "new failed")
+
+		err = scopes.Provide(func() *Session { return nil })
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(), "must be provided before the first request scope is created")
+	})
+
+	t.Run("parent values are built on demand", func(t *testing.T) {
+		c := New()
+		var calls int
+		require.NoError(t, c.Provide(func() (*Config, error) {
+			calls++
+			return nil, errors.New("great sadness")
+		}), "provide failed")
+		require.NoError(t, c.Provide(func() *Request { return &Request{ID: 1} }), "provide failed")
+
+		s, err := c.RequestScopes().New()
+		require.NoError(t, err, "failing parent constructors must not prevent creating scopes")
+		assert.Zero(t, calls, "parent constructors must not be called until needed")
+
+		require.NoError(t, s.Invoke(func(r *Request) {
+			assert.Equal(t, 1, r.ID)
+		}), "invoke failed")
+
+		err = s.Invoke(func(*Config) {})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".TestRequestScopes\S+`,
+			`failed to build \*dig.Config:`,
+			`great sadness`,
+		)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("freeze failures", func(t *testing.T) {
+		c := New(DeferAcyclicVerification())
+		require.NoError(t, c.Provide(func(*Request) *Config { return nil }), "provide failed")
+		require.NoError(t, c.Provide(func(*Config) *Request { return nil }), "provide failed")
+
+		scopes := c.RequestScopes()
+		for i := 0; i < 2; i++ {
+			_, err := scopes.New()
+			require.Error(t, err, "new must fail")
+			assert.True(t, IsCycleDetected(err), "expected a cycle error")
+			assert.Contains(t, err.Error(), `cannot freeze container "root":`)
+		}
+	})
+
+	t.Run("scoped errors", func(t *testing.T) {
+		scopes := New().RequestScopes()
+		require.NoError(t, scopes.Provide(func(*Request) (*Session, error) {
+			return nil, errors.New("great sadness")
+		}), "provide failed")
+
+		s, err := scopes.New()
+		require.NoError(t, err, "new failed")
+
+		err = s.Invoke(func(*Session) {})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".TestRequestScopes\S+`,
+			`failed to build \*dig.Session:`,
+			`missing dependencies for function "go.uber.org/dig".TestRequestScopes\S+`,
+			`type \*dig.Request is not in the container`,
+		)
+
+		s, err = scopes.New(&Request{})
+		require.NoError(t, err, "new failed")
+		err = s.Invoke(func(*Session) {})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".TestRequestScopes\S+`,
+			`failed to build \*dig.Session:`,
+			`great sadness`,
+		)
+
+		_, err = scopes.New(&Request{}, &Request{})
+		require.Error(t, err, "new must fail")
+		assert.Contains(t, err.Error(), "cannot add *dig.Request to a request scope more than once")
+
+		_, err = scopes.New(nil)
+		require.Error(t, err, "new must fail")
+		assert.Contains(t, err.Error(), "cannot add an untyped nil to a request scope")
+	})
+
+	t.Run("one scope per goroutine", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *Config { return &Config{} }), "provide failed")
+		require.NoError(t, c.Provide(func() []string { return []string{"a"} }, Group("names")), "provide failed")
+
+		scopes := c.RequestScopes()
+		require.NoError(t, scopes.Provide(func(cfg *Config, r *Request) *Session {
+			return &Session{Config: cfg, Request: r}
+		}), "provide failed")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				s, err := scopes.New(&Request{ID: i})
+				if !assert.NoError(t, err, "new failed") {
+					return
+				}
+				assert.NoError(t, s.Invoke(func(sess *Session, p struct {
+					In
+
+					Names [][]string `group:"names"`
+				}) {
+					assert.Equal(t, i, sess.Request.ID)
+					assert.Len(t, p.Names, 1)
+				}), "invoke failed")
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	// Run with -race to check that scopes don't share state which isn't
+	// frozen.
+	t.Run("concurrent first use", func(t *testing.T) {
+		var o recordingObserver
+		c := New(WithObserver(&o))
+
+		var configs int
+		require.NoError(t, c.Provide(func() *Config {
+			configs++
+			return &Config{Name: "app"}
+		}), "provide failed")
+		require.NoError(t, c.Decorate(func(cfg *Config) *Config {
+			return &Config{Name: cfg.Name + "!"}
+		}), "decorate failed")
+		require.NoError(t, c.Provide(func() string { return "a" }, Group("names")), "provide failed")
+		require.NoError(t, c.Decorate(strings.ToUpper, Group("names")), "decorate failed")
+
+		scopes := c.RequestScopes()
+		require.NoError(t, scopes.Provide(func(cfg *Config, r *Request) (*Session, error) {
+			return &Session{Config: cfg, Request: r}, nil
+		}, Timeout(time.Minute), Retry(RetryPolicy{Attempts: 2})), "provide failed")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				s, err := scopes.New(&Request{ID: i})
+				if !assert.NoError(t, err, "new failed") {
+					return
+				}
+				assert.NoError(t, s.Invoke(func(sess *Session, p struct {
+					In
+
+					Names []string `group:"names"`
+				}) {
+					assert.Equal(t, "app!", sess.Config.Name)
+					assert.Equal(t, i, sess.Request.ID)
+					assert.Equal(t, []string{"A"}, p.Names)
+				}), "invoke failed")
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, configs, "parent values must be built once")
+	})
+
+	// Run with -race to check that the parent is locked while its values
+	// are built.
+	t.Run("concurrent use with the parent", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+		require.NoError(t, c.Provide(func() *Config { return &Config{Name: "app"} }), "provide failed")
+		require.NoError(t, child.Provide(func(cfg *Config) *Request { return &Request{ID: 1} }), "provide failed")
+
+		scopes := c.RequestScopes()
+		require.NoError(t, scopes.Provide(func(cfg *Config) *Session {
+			return &Session{Config: cfg}
+		}), "provide failed")
+		_, err := scopes.New()
+		require.NoError(t, err, "new failed")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+
+				s, err := scopes.New()
+				if !assert.NoError(t, err, "new failed") {
+					return
+				}
+				assert.NoError(t, s.Invoke(func(sess *Session) {
+					assert.Equal(t, "app", sess.Config.Name)
+				}), "invoke failed")
+			}()
+			go func() {
+				defer wg.Done()
+
+				assert.NoError(t, child.Invoke(func(cfg *Config, _ *Request) {
+					assert.Equal(t, "app", cfg.Name)
+				}), "invoke failed")
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Seal makes the tree of containers this container belongs to immutable once
+// the application has started. Provide, Decorate and Detach then fail with an
+// error for which IsSealed returns true. Child still returns a container, but
+// the container is unusable: its first use fails with the same error. Values
+// may still be resolved with Invoke.
+//
+//   if err := c.Seal(); err != nil {
+//     return err
+//   }
+//   return c.Invoke(run)
+//
+// In return, resolutions are cheaper: Seal verifies that the dependency graph
+// is acyclic once, and precomputes the providers and decorators of every
+// value. The dependencies of constructors and invoked functions are checked
+// only once. Seal returns an error if the dependency graph has a cycle, in which
+// case the containers are not sealed. Sealing a sealed container does
+// nothing.
+//
+// Once a function was invoked successfully on a sealed container, the
+// arguments built for it are reused by the Invoke calls of functions of the
+// same type on that container: they build nothing and take no locks, and may
+// therefore run concurrently. Functions which consume value groups don't use
+// this fast path, as their groups are built and shuffled for each call. Other
+// Invoke calls build and store values, and are no more safe for concurrent use
+// than on other containers; use RequestScopes to resolve those concurrently.
+func (c *Container) Seal() error {
+	if c.detached {
+		return fmt.Errorf("container %q was detached", c.Path())
+	}
+	defer c.lockShared()()
+	root := c.getRoot()
+	if root.sealed {
+		return nil
+	}
+
+	containers := root.subtree()
+	for _, cc := range containers {
+		if !cc.isVerifiedAcyclic {
+			if err := cc.verifyAcyclic(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, cc := range containers {
+		cc.lookups = cc.computeLookups()
+	}
+	for _, n := range root.subtreeNodes() {
+		// The providers of the dependencies of n can no longer change, so
+		// they needn't be checked again before n is called.
+		n.depsChecked = shallowCheckDependencies(n.providedTo, n.paramList) == nil
+	}
+	root.sealed = true
+	return nil
+}
+
+// IsSealed reports whether the given error was returned because a container
+// was sealed with Seal.
+func IsSealed(err error) bool {
+	_, ok := RootCause(err).(errSealed)
+	return ok
+}
+
+// errSealed is returned when a container is modified after it was sealed, or
+// when a container created by Child after it was sealed is used.
+type errSealed struct {
+	Path string
+
+	// Whether the container was created after it was sealed.
+	Created bool
+}
+
+func (e errSealed) Error() string {
+	if e.Created {
+		return fmt.Sprintf("container %q was created after its parent was sealed: it cannot be used", e.Path)
+	}
+	return fmt.Sprintf("container %q is sealed: it can no longer be modified", e.Path)
+}
+
+// errIfSealed returns an errSealed if the tree of containers this container
+// belongs to was sealed.
+func (c *Container) errIfSealed() error {
+	if c.getRoot().sealed {
+		return errSealed{Path: c.Path()}
+	}
+	return nil
+}
+
+// subtree returns this container followed by its descendants.
+func (c *Container) subtree() []*Container {
+	cs := []*Container{c}
+	for _, cc := range c.children {
+		cs = append(cs, cc.subtree()...)
+	}
+	return cs
+}
+
+// lookups holds the providers and decorators of the values resolved from a
+// sealed container, which can no longer change. Values without providers or
+// decorators are not included.
+type lookups struct {
+	valueProviders    map[key][]provider
+	groupProviders    map[key][]provider
+	decorators        map[key][]*node
+	elementDecorators map[key][]*elementDecorator
+
+	// Parameters of the types of functions invoked on the container whose
+	// dependencies are all provided, by function type.
+	invoked map[reflect.Type]paramList
+
+	// Arguments built for the types of functions invoked successfully on
+	// the container, by function type. It is read without locks by Invoke.
+	args sync.Map // map[reflect.Type][]reflect.Value
+}
+
+// checkedParams returns the parameters of the functions of the given type
+// invoked on this container if the container is sealed and they are known to
+// have all their dependencies provided.
+func (c *Container) checkedParams(t reflect.Type) (paramList, bool) {
+	if c.lookups == nil {
+		return paramList{}, false
+	}
+	pl, ok := c.lookups.invoked[t]
+	return pl, ok
+}
+
+// computeLookups looks up the providers and decorators of the values known to
+// this container and its ancestors.
+func (c *Container) computeLookups() *lookups {
+	l := &lookups{
+		valueProviders:    make(map[key][]provider),
+		groupProviders:    make(map[key][]provider),
+		decorators:        make(map[key][]*node),
+		elementDecorators: make(map[key][]*elementDecorator),
+		invoked:           make(map[reflect.Type]paramList),
+	}
+	for _, p := range c.lineage() {
+		for k := range p.providers {
+			if len(k.group) > 0 {
+				l.groupProviders[k] = c.getGroupProviders(k.group, k.t)
+			} else {
+				l.valueProviders[k] = c.getValueProviders(k.name, k.t)
+			}
+		}
+		for k := range p.decorators {
+			l.decorators[k] = c.getDecorators(k)
+		}
+		for k := range p.elementDecorators {
+			l.elementDecorators[k] = c.getElementDecorators(k)
+		}
+	}
+	return l
+}
+
+// invokedArgs returns the arguments built for a function of the given type
+// invoked on this container before, if the container is sealed.
+func (c *Container) invokedArgs(t reflect.Type) ([]reflect.Value, bool) {
+	if c.lookups == nil {
+		return nil, false
+	}
+	args, ok := c.lookups.args.Load(t)
+	if !ok {
+		return nil, false
+	}
+	return args.([]reflect.Value), true
+}
+
+// rememberArgs records the arguments built for a function of the given type
+// invoked on this container if it is sealed, so that later Invoke calls reuse
+// them. Arguments which may change are not recorded: those built while the
+// changes made to the containers may be rolled back, and the values of value
+// groups.
+func (c *Container) rememberArgs(t reflect.Type, pl paramList, args []reflect.Value) {
+	if c.lookups == nil || c.journal() != nil {
+		return
+	}
+
+	var groups bool
+	walkParam(pl, paramVisitorFunc(func(p param) bool {
+		_, ok := p.(paramGroupedSlice)
+		groups = groups || ok
+		return !groups
+	}))
+	if !groups {
+		c.lookups.args.Store(t, args)
+	}
+}
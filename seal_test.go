@@ -0,0 +1,221 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeal(t *testing.T) {
+	type A struct{}
+	type B struct{}
+	type C struct{}
+
+	t.Run("modifications fail", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+		require.NoError(t, c.Provide(func() *A { return &A{} }), "provide failed")
+		require.NoError(t, child.Seal(), "seal failed")
+
+		err := c.Provide(func() *B { return &B{} })
+		require.Error(t, err, "provide must fail")
+		assert.True(t, IsSealed(err), "expected a sealed error")
+		assert.Contains(t, err.Error(), `container "root" is sealed: it can no longer be modified`)
+
+		err = child.Decorate(func(a *A) *A { return a })
+		require.Error(t, err, "decorate must fail")
+		assert.True(t, IsSealed(err), "expected a sealed error")
+		assert.Contains(t, err.Error(), `container "root/child" is sealed`)
+
+		err = child.Detach()
+		require.Error(t, err, "detach must fail")
+		assert.True(t, IsSealed(err), "expected a sealed error")
+
+		grandchild := child.Child("grandchild")
+		assert.Equal(t, []*Container{child}, c.Children())
+		assert.Empty(t, child.Children(), "children of sealed containers must not be added")
+		err = grandchild.Provide(func() *B { return &B{} })
+		require.Error(t, err, "provide must fail")
+		assert.True(t, IsSealed(err), "expected a sealed error")
+
+		assert.NoError(t, c.Seal(), "sealing twice must succeed")
+	})
+
+	t.Run("children created after sealing cannot be used", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *A { return &A{} }), "provide failed")
+		require.NoError(t, c.Seal(), "seal failed")
+
+		child := c.Child("child")
+		err := child.Invoke(func(*A) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assert.True(t, IsSealed(err), "expected a sealed error")
+		assert.Contains(t, err.Error(),
+			`container "root/child" was created after its parent was sealed: it cannot be used`)
+
+		err = child.Decorate(func(a *A) *A { return a })
+		require.Error(t, err, "decorate must fail")
+		assert.True(t, IsSealed(err), "expected a sealed error")
+
+		_, err = child.RequestScopes().New()
+		require.Error(t, err, "new must fail")
+		assert.True(t, IsSealed(err), "expected a sealed error")
+
+		err = child.Child("grandchild").Invoke(func(*A) {})
+		require.Error(t, err, "invoke must fail")
+		assert.True(t, IsSealed(err), "expected a sealed error")
+
+		require.NoError(t, c.Invoke(func(*A) {}), "parent must still be usable")
+	})
+
+	t.Run("invoke", func(t *testing.T) {
+		c := New()
+		child := c.Child("child")
+		require.NoError(t, c.Provide(func() *A { return &A{} }), "provide failed")
+		require.NoError(t, child.Provide(func(*A) *B { return &B{} }), "provide failed")
+		require.NoError(t, child.Provide(func(*A) *C { return &C{} }, Group("cs")), "provide failed")
+		require.NoError(t, child.Decorate(func(*B) *B { return nil }), "decorate failed")
+		require.NoError(t, c.Seal(), "seal failed")
+		assert.NotNil(t, c.lookups, "lookups must be precomputed")
+		assert.NotNil(t, child.lookups, "lookups must be precomputed")
+
+		require.NoError(t, child.Invoke(func(b *B, cs struct {
+			In
+
+			Cs []*C `group:"cs"`
+		}) {
+			assert.Nil(t, b, "decorator must be applied")
+			assert.Len(t, cs.Cs, 1)
+		}), "invoke failed")
+
+		invoked := func(*A) {}
+		require.NoError(t, child.Invoke(invoked), "invoke failed")
+		_, ok := child.checkedParams(reflect.TypeOf(invoked))
+		assert.True(t, ok, "parameters of invoked functions must be remembered")
+		require.NoError(t, child.Invoke(invoked), "invoke failed")
+
+		err := c.Invoke(func(*B) {})
+		require.Error(t, err, "values private to the child must not be visible")
+		assert.Contains(t, err.Error(), "type *dig.B is not in the container")
+	})
+
+	// Run with -race to check that the fast path is read-only.
+	t.Run("invoke reuses arguments", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() *A { return &A{} }), "provide failed")
+		require.NoError(t, c.Provide(func(*A) *C { return &C{} }, Group("cs")), "provide failed")
+		require.NoError(t, c.Seal(), "seal failed")
+
+		invoked := func(*A) {}
+		_, ok := c.invokedArgs(reflect.TypeOf(invoked))
+		assert.False(t, ok, "arguments must not be known before the first invoke")
+		require.NoError(t, c.Invoke(invoked), "invoke failed")
+		_, ok = c.invokedArgs(reflect.TypeOf(invoked))
+		assert.True(t, ok, "arguments must be remembered")
+
+		type in struct {
+			In
+
+			Cs []*C `group:"cs"`
+		}
+		require.NoError(t, c.Invoke(func(in) {}), "invoke failed")
+		_, ok = c.invokedArgs(reflect.TypeOf(func(in) {}))
+		assert.False(t, ok, "value groups must be built for each invoke")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, c.Invoke(func(a *A) {
+					assert.NotNil(t, a)
+				}), "invoke failed")
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("missing dependencies", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func(*A) *B { return &B{} }), "provide failed")
+		require.NoError(t, c.Seal(), "seal failed")
+
+		invoked := func(*A) {}
+		require.Error(t, c.Invoke(invoked), "invoke must fail")
+		_, ok := c.checkedParams(reflect.TypeOf(invoked))
+		assert.False(t, ok, "failed checks must not be remembered")
+
+		err := c.Invoke(func(*B) {})
+		require.Error(t, err, "invoke must fail")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".TestSeal\S+`,
+			`failed to build \*dig.B:`,
+			`missing dependencies for function "go.uber.org/dig".TestSeal\S+`,
+			`type \*dig.A is not in the container`,
+		)
+	})
+
+	t.Run("cycles", func(t *testing.T) {
+		c := New(DeferAcyclicVerification())
+		require.NoError(t, c.Provide(func(*B) *A { return &A{} }), "provide failed")
+		require.NoError(t, c.Provide(func(*A) *B { return &B{} }), "provide failed")
+
+		err := c.Seal()
+		require.Error(t, err, "seal must fail")
+		assert.True(t, IsCycleDetected(err), "expected a cycle")
+		assert.NoError(t, c.Provide(func() *C { return &C{} }),
+			"containers must not be sealed if sealing failed")
+	})
+}
+
+func BenchmarkSealedInvoke(b *testing.B) {
+	type A struct{}
+	type B struct{}
+	type C struct{}
+
+	for _, sealed := range []bool{false, true} {
+		b.Run(map[bool]string{false: "unsealed", true: "sealed"}[sealed], func(b *testing.B) {
+			c := New()
+			child := c.Child("child").Child("grandchild")
+			require.NoError(b, c.Provide(func() *A { return &A{} }), "provide failed")
+			require.NoError(b, c.Provide(func(*A) *B { return &B{} }), "provide failed")
+			require.NoError(b, c.Decorate(func(b *B) *B { return b }), "decorate failed")
+			require.NoError(b, child.Provide(func(*A, *B) *C { return &C{} }), "provide failed")
+			if sealed {
+				require.NoError(b, c.Seal(), "seal failed")
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := child.Invoke(func(*A, *B, *C) {}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
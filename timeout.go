@@ -0,0 +1,274 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.uber.org/dig/internal/digreflect"
+)
+
+var _contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Timeout is a ProvideOption which limits how long the constructor may run.
+// If the constructor doesn't return within the given duration, the value it
+// was called for fails to build with an error naming the constructor and the
+// dependencies which led to it. IsTimeout reports whether an error returned by
+// Invoke is such an error.
+//
+// The context.Context arguments of the constructor are cancelled at the
+// deadline, which allows it to stop its work. Like any other dependency, the
+// context.Context must be provided to the container.
+//
+//   c.Provide(func() context.Context { return ctx })
+//   c.Provide(func(ctx context.Context, cfg *Config) (*sql.DB, error) {
+//     return connect(ctx, cfg.DSN)
+//   }, dig.Timeout(5*time.Second))
+//
+// Constructors which ignore the deadline keep running in their own goroutine
+// after it, and their results are discarded. Until they return, they are not
+// called again: building their values fails with a timeout error instead.
+// Constructors which return after their timeout according to the clock of the
+// container are also considered to have timed out.
+//
+// The constructor runs in a different goroutine than Invoke, so unless
+// RecoverFromPanics is used, its panics are raised again from Invoke as a
+// PanicError which holds the stack of the constructor. Timeout cannot be used
+// with Decorate.
+func Timeout(d time.Duration) ProvideOption {
+	return provideOptionFunc(func(opts *provideOptions) {
+		opts.Timeout = d
+	})
+}
+
+// buildState tracks the values being built from a container or a request
+// scope.
+type buildState struct {
+	// Values being built, starting with the outermost. They form the
+	// dependency path reported by timeout errors.
+	path []cycleEntry
+
+	// Constructors which timed out, mapped to channels which are closed
+	// once they return.
+	abandoned map[*node]chan struct{}
+}
+
+// buildStateOf returns the build state for the values built from c.
+//
+// Request scopes track their own state as they may be used concurrently with
+// each other, and build the values of their parent in the parent. Other
+// containers share the state of their root.
+func buildStateOf(c containerStore) *buildState {
+	switch c := c.(type) {
+	case *Container:
+		return &c.getRoot().build
+	case *RequestScope:
+		return &c.build
+	}
+	return nil
+}
+
+// callProvider calls the constructor of n to build the values with the given
+// key from c, recording them in the dependency path of c.
+func callProvider(c containerStore, k key, n provider) error {
+	if s := buildStateOf(c); s != nil {
+		s.path = append(s.path, cycleEntry{
+			Key:  k,
+			Func: n.Location(),
+			Path: n.ContainerPath(),
+		})
+		defer func() {
+			s.path = s.path[:len(s.path)-1]
+		}()
+	}
+	return n.Call(c)
+}
+
+// dependencyPath returns a copy of the dependency path being built from c.
+func dependencyPath(c containerStore) []cycleEntry {
+	s := buildStateOf(c)
+	if s == nil {
+		return nil
+	}
+	return append([]cycleEntry(nil), s.path...)
+}
+
+// callWithTimeout calls the constructor of n with the given arguments, and
+// gives up with an errTimedOut if it doesn't return within the timeout of n.
+//
+// The constructor runs in its own goroutine, which keeps running after the
+// timeout until the constructor returns. The constructor isn't called again
+// from c in the meantime. Its panics are passed to the calling goroutine as a
+// PanicError unless they are recovered.
+//
+// The timer which abandons the constructor runs on the wall clock, but
+// whether a constructor which returned overran its timeout is decided by the
+// clock of c, which also times the constructor in startup reports.
+func (n *node) callWithTimeout(c containerStore, args []reflect.Value, recoverPanics bool) ([]reflect.Value, error) {
+	s := buildStateOf(c)
+	if s != nil {
+		if returned, ok := s.abandoned[n]; ok {
+			select {
+			case <-returned:
+				delete(s.abandoned, n)
+			default:
+				return nil, errTimedOut{
+					Func:    n.location,
+					Path:    n.ContainerPath(),
+					Timeout: n.timeout,
+					Running: true,
+					Deps:    dependencyPath(c),
+				}
+			}
+		}
+	}
+
+	clock := clockOf(c)
+	start := clock()
+
+	// Cancel the contexts the constructor receives at the deadline. They
+	// are released once it returns, which may be after the deadline.
+	var cancels []context.CancelFunc
+	args = append([]reflect.Value(nil), args...)
+	for i, arg := range args {
+		if arg.Type() != _contextType {
+			continue
+		}
+
+		parent, _ := arg.Interface().(context.Context)
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, cancel := context.WithTimeout(parent, n.timeout)
+		cancels = append(cancels, cancel)
+		args[i] = reflect.ValueOf(&ctx).Elem()
+	}
+
+	type result struct {
+		results []reflect.Value
+		err     error
+	}
+	done := make(chan result, 1) // buffered so that late constructors don't leak
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		results, err := callFunc(reflect.ValueOf(n.ctor), args, true /* recoverPanics */)
+		for _, cancel := range cancels {
+			cancel()
+		}
+		done <- result{results, err}
+	}()
+
+	timer := time.NewTimer(n.timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		if p, ok := r.err.(PanicError); ok && !recoverPanics {
+			panic(p)
+		}
+		if clock().Sub(start) > n.timeout {
+			return nil, errTimedOut{
+				Func:    n.location,
+				Path:    n.ContainerPath(),
+				Timeout: n.timeout,
+				Deps:    dependencyPath(c),
+			}
+		}
+		return r.results, r.err
+	case <-timer.C:
+		if s != nil {
+			if s.abandoned == nil {
+				s.abandoned = make(map[*node]chan struct{})
+			}
+			s.abandoned[n] = returned
+		}
+		return nil, errTimedOut{
+			Func:    n.location,
+			Path:    n.ContainerPath(),
+			Timeout: n.timeout,
+			Deps:    dependencyPath(c),
+		}
+	}
+}
+
+// awaitAbandoned waits for the call of the constructor of n which was
+// abandoned by c after it timed out, if any, to return.
+func (n *node) awaitAbandoned(c containerStore) {
+	s := buildStateOf(c)
+	if s == nil {
+		return
+	}
+	if returned, ok := s.abandoned[n]; ok {
+		<-returned
+		delete(s.abandoned, n)
+	}
+}
+
+// IsTimeout reports whether the given error, returned by Invoke, was caused by
+// a constructor which didn't return within the duration given to Timeout.
+func IsTimeout(err error) bool {
+	_, ok := RootCause(err).(errTimedOut)
+	return ok
+}
+
+// errTimedOut is returned when a constructor didn't return within its
+// timeout.
+type errTimedOut struct {
+	Func    *digreflect.Func
+	Path    string // path of the child container, if any
+	Timeout time.Duration
+
+	// Whether the constructor was not called because it didn't return
+	// since it timed out previously.
+	Running bool
+
+	// Values being built when the constructor was called, starting with
+	// the outermost.
+	Deps []cycleEntry
+}
+
+func (e errTimedOut) Error() string {
+	// We get something like,
+	//
+	//   function "path/to/package".NewBar (path/to/file.go:42) timed out after 5s building:
+	//   	foo provided by "path/to/package".NewFoo (path/to/file.go:12)
+	//   	depends on bar provided by "path/to/package".NewBar (path/to/file.go:42)
+	//
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "function %v%v timed out after %v", e.Func, inContainer(e.Path), e.Timeout)
+	if e.Running {
+		b.WriteString(" and has not returned yet")
+	}
+	for i, entry := range e.Deps {
+		if i == 0 {
+			b.WriteString(" building:\n\t")
+		} else {
+			b.WriteString("\n\tdepends on ")
+		}
+		fmt.Fprintf(b, "%v provided by %v%v", entry.Key, entry.Func, inContainer(entry.Path))
+	}
+	return b.String()
+}
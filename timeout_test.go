@@ -0,0 +1,189 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeout(t *testing.T) {
+	type DB struct{}
+	type Server struct{}
+
+	t.Run("constructor times out", func(t *testing.T) {
+		unblock := make(chan struct{})
+		defer close(unblock)
+
+		c := New()
+		require.NoError(t, c.Provide(func() *DB {
+			<-unblock
+			return &DB{}
+		}, Timeout(10*time.Millisecond)), "provide failed")
+		require.NoError(t, c.Provide(func(*DB) *Server { return &Server{} }), "provide failed")
+
+		err := c.Invoke(func(*Server) {})
+		require.Error(t, err, "invoke must fail")
+		assert.True(t, IsTimeout(err), "expected a timeout error")
+		assertErrorMatches(t, err,
+			`could not build arguments for function "go.uber.org/dig".TestTimeout\S+`,
+			`failed to build \*dig.Server:`,
+			`could not build arguments for function "go.uber.org/dig".TestTimeout\S+`,
+			`failed to build \*dig.DB:`,
+			`function "go.uber.org/dig".TestTimeout\S+ \(\S+\) timed out after 10ms building:`,
+			`\*dig.Server provided by "go.uber.org/dig".TestTimeout\S+ \(\S+\)`,
+			`depends on \*dig.DB provided by "go.uber.org/dig".TestTimeout\S+ \(\S+\)`,
+		)
+		assert.Empty(t, c.build.path, "dependency path must be cleared")
+	})
+
+	t.Run("constructor isn't called again until it returns", func(t *testing.T) {
+		started := make(chan struct{}, 2)
+		unblock := make(chan struct{})
+
+		c := New()
+		require.NoError(t, c.Provide(func() *DB {
+			started <- struct{}{}
+			<-unblock
+			return &DB{}
+		}, Timeout(10*time.Millisecond)), "provide failed")
+
+		err := c.Invoke(func(*DB) {})
+		require.Error(t, err, "invoke must fail")
+		assert.True(t, IsTimeout(err), "expected a timeout error")
+		<-started
+
+		err = c.Invoke(func(*DB) {})
+		require.Error(t, err, "invoke must fail")
+		assert.True(t, IsTimeout(err), "expected a timeout error")
+		assert.Contains(t, err.Error(), "timed out after 10ms and has not returned yet")
+		assert.Empty(t, started, "constructor must not be called again")
+
+		close(unblock)
+		for i := 0; ; i++ {
+			err = c.Invoke(func(db *DB) {
+				assert.NotNil(t, db)
+			})
+			if err == nil {
+				break
+			}
+			require.True(t, IsTimeout(err), "expected a timeout error")
+			require.Less(t, i, 100, "constructor did not return")
+			time.Sleep(time.Millisecond)
+		}
+		<-started
+	})
+
+	t.Run("context is cancelled at the deadline", func(t *testing.T) {
+		ctxErr := make(chan error, 1)
+
+		c := New()
+		require.NoError(t, c.Provide(context.Background), "provide failed")
+		require.NoError(t, c.Provide(func(ctx context.Context) (*DB, error) {
+			<-ctx.Done()
+			ctxErr <- ctx.Err()
+			return nil, ctx.Err()
+		}, Timeout(10*time.Millisecond)), "provide failed")
+
+		err := c.Invoke(func(*DB) {})
+		require.Error(t, err, "invoke must fail")
+		assert.True(t, IsTimeout(err), "expected a timeout error")
+		assert.Equal(t, context.DeadlineExceeded, <-ctxErr)
+	})
+
+	t.Run("constructor returns in time", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() (*DB, error) {
+			return &DB{}, nil
+		}, Timeout(time.Minute)), "provide failed")
+
+		require.NoError(t, c.Invoke(func(db *DB) {
+			assert.NotNil(t, db)
+		}), "invoke failed")
+	})
+
+	t.Run("timeouts are measured with the clock of the container", func(t *testing.T) {
+		clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		c := New(setClock(clock.Now))
+		require.NoError(t, c.Provide(func() *DB {
+			clock.Sleep(2 * time.Second)
+			return &DB{}
+		}, Timeout(time.Second)), "provide failed")
+
+		err := c.Invoke(func(*DB) {
+			t.Fatal("this function must not be called")
+		})
+		require.Error(t, err, "invoke must fail")
+		assert.True(t, IsTimeout(err), "expected a timeout error")
+		assert.NotContains(t, err.Error(), "has not returned yet")
+	})
+
+	t.Run("errors are not timeouts", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(func() (*DB, error) {
+			return nil, assert.AnError
+		}, Timeout(time.Minute)), "provide failed")
+
+		err := c.Invoke(func(*DB) {})
+		require.Error(t, err, "invoke must fail")
+		assert.False(t, IsTimeout(err), "unexpected timeout error")
+		assert.Equal(t, assert.AnError, RootCause(err))
+	})
+
+	t.Run("panics", func(t *testing.T) {
+		ctor := func() *DB { panic("great sadness") }
+
+		c := New()
+		require.NoError(t, c.Provide(ctor, Timeout(time.Minute)), "provide failed")
+		func() {
+			defer func() {
+				p, ok := recover().(PanicError)
+				require.True(t, ok, "expected a PanicError")
+				assert.Equal(t, "great sadness", p.Value)
+				assert.Contains(t, string(p.Stack), "TestTimeout", "stack of the constructor must be kept")
+			}()
+			c.Invoke(func(*DB) {})
+		}()
+
+		c = New(RecoverFromPanics())
+		require.NoError(t, c.Provide(ctor, Timeout(time.Minute)), "provide failed")
+		err := c.Invoke(func(*DB) {})
+		require.Error(t, err, "invoke must fail")
+		assert.IsType(t, PanicError{}, RootCause(err))
+	})
+
+	t.Run("invalid timeouts", func(t *testing.T) {
+		c := New()
+
+		err := c.Provide(func() *DB { return nil }, Timeout(-time.Second))
+		require.Error(t, err, "provide must fail")
+		assert.Contains(t, err.Error(), "invalid dig.Timeout(-1s): timeouts cannot be negative")
+
+		require.NoError(t, c.Provide(func() *DB { return nil }), "provide failed")
+		err = c.Decorate(func(db *DB) *DB { return db }, Timeout(time.Second))
+		require.Error(t, err, "decorate must fail")
+		assert.Contains(t, err.Error(), "cannot use dig.Timeout with decorators")
+	})
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"sort"
+	"time"
+
+	"go.uber.org/dig/internal/digreflect"
+)
+
+// StartupReport describes the time spent calling the constructors and
+// decorators of a container.
+type StartupReport struct {
+	// Constructors and decorators which were called, from the most to the
+	// least expensive.
+	Constructors []ConstructorTiming
+
+	// The chain of dependencies which took the longest to build, starting
+	// with the constructor that was called first. Its cost is the sum of the
+	// durations of the constructors on it.
+	CriticalPath []ConstructorTiming
+}
+
+// ConstructorTiming describes a call to a constructor or a decorator.
+type ConstructorTiming struct {
+	// Identifier of the constructor.
+	ID NodeID
+
+	// Location of the constructor.
+	Func *digreflect.Func
+
+	// Path of the container the constructor was provided to.
+	Container string
+
+	// Time at which the constructor was called, relative to the first
+	// Invoke on the root container.
+	Start time.Duration
+
+	// Time spent in the constructor, excluding the time spent building its
+	// dependencies.
+	Duration time.Duration
+}
+
+// StartupReport reports how long the constructors and decorators provided to
+// this container and its descendants took. Constructors of request scopes
+// are not included.
+//
+// Element decorators are called once for each value of their value group:
+// their timing covers all of these calls. They are not part of the critical
+// path.
+//
+//   r := c.StartupReport()
+//   for _, t := range r.CriticalPath {
+//     log.Printf("%v: %v", t.Func, t.Duration)
+//   }
+func (c *Container) StartupReport() StartupReport {
+	var nodes []*node
+	for _, n := range c.subtreeNodes() {
+		if !n.startedAt.IsZero() {
+			nodes = append(nodes, n)
+		}
+	}
+
+	// Nodes are sorted by when they were called first so that ties below are
+	// broken deterministically.
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].startedAt.Before(nodes[j].startedAt)
+	})
+
+	invokedAt := c.getRoot().invokedAt
+	timing := func(n *node) ConstructorTiming {
+		return ConstructorTiming{
+			ID:        n.id,
+			Func:      n.location,
+			Container: n.containerFullPath(),
+			Start:     n.startedAt.Sub(invokedAt),
+			Duration:  n.duration,
+		}
+	}
+
+	var r StartupReport
+	for _, n := range nodes {
+		r.Constructors = append(r.Constructors, timing(n))
+	}
+	for _, d := range c.subtreeElementDecorators() {
+		r.Constructors = append(r.Constructors, ConstructorTiming{
+			ID:        d.id,
+			Func:      d.location,
+			Container: d.container.Path(),
+			Start:     d.startedAt.Sub(invokedAt),
+			Duration:  d.duration,
+		})
+	}
+	sort.SliceStable(r.Constructors, func(i, j int) bool {
+		return r.Constructors[i].Duration > r.Constructors[j].Duration
+	})
+
+	for _, n := range criticalPath(nodes) {
+		r.CriticalPath = append(r.CriticalPath, timing(n))
+	}
+	return r
+}
+
+// Changes the source of the current time for the timings of the container.
+//
+// This will help provide determinism during tests.
+func setClock(clock func() time.Time) Option {
+	return optionFunc(func(c *Container) {
+		c.clock = clock
+	})
+}
+
+// clockOf returns the source of the current time of the container backing c.
+func clockOf(c containerStore) func() time.Time {
+	switch c := c.(type) {
+	case *Container:
+		return c.clock
+	case *RequestScope:
+		return c.scopes.parent.clock
+	}
+	return time.Now
+}
+
+// markInvoked records the time of the first Invoke on the tree of
+// containers this container belongs to.
+func (c *Container) markInvoked() {
+	root := c.getRoot()
+	if root.invokedAt.IsZero() {
+		root.invokedAt = root.clock()
+	}
+}
+
+// subtreeNodes returns the constructors and decorators provided to this
+// container and its descendants.
+func (c *Container) subtreeNodes() []*node {
+	nodes := append([]*node(nil), c.nodes...)
+	for _, ds := range c.decorators {
+		nodes = append(nodes, ds...)
+	}
+	for _, cc := range c.children {
+		nodes = append(nodes, cc.subtreeNodes()...)
+	}
+
+	// A decorator may decorate several values.
+	seen := make(map[*node]struct{}, len(nodes))
+	unique := nodes[:0]
+	for _, n := range nodes {
+		if _, ok := seen[n]; !ok {
+			seen[n] = struct{}{}
+			unique = append(unique, n)
+		}
+	}
+	return unique
+}
+
+// subtreeElementDecorators returns the element decorators registered with
+// this container and its descendants which were called, ordered by when they
+// were called first.
+func (c *Container) subtreeElementDecorators() []*elementDecorator {
+	var decorators []*elementDecorator
+	var collect func(c *Container)
+	collect = func(c *Container) {
+		for _, ds := range c.elementDecorators {
+			for _, d := range ds {
+				if !d.startedAt.IsZero() {
+					decorators = append(decorators, d)
+				}
+			}
+		}
+		for _, cc := range c.children {
+			collect(cc)
+		}
+	}
+	collect(c)
+
+	sort.SliceStable(decorators, func(i, j int) bool {
+		return decorators[i].startedAt.Before(decorators[j].startedAt)
+	})
+	return decorators
+}
+
+// criticalPath returns the chain of dependencies among the given nodes whose
+// constructors took the longest in total, starting with the dependency which
+// was called first.
+func criticalPath(nodes []*node) []*node {
+	called := make(map[*node]struct{}, len(nodes))
+	for _, n := range nodes {
+		called[n] = struct{}{}
+	}
+
+	costs := make(map[*node]time.Duration, len(nodes))
+	next := make(map[*node]*node, len(nodes))
+	var cost func(n *node) time.Duration
+	cost = func(n *node) time.Duration {
+		if d, ok := costs[n]; ok {
+			return d
+		}
+		// Guards against cycles, which may only exist between containers
+		// which were verified separately.
+		costs[n] = n.duration
+
+		var slowest time.Duration
+		for _, dep := range n.dependencies() {
+			if _, ok := called[dep]; !ok {
+				continue
+			}
+			if d := cost(dep); next[n] == nil || d > slowest {
+				slowest, next[n] = d, dep
+			}
+		}
+		costs[n] = n.duration + slowest
+		return costs[n]
+	}
+
+	var last *node
+	for _, n := range nodes {
+		if last == nil || cost(n) > cost(last) {
+			last = n
+		}
+	}
+
+	var path []*node
+	seen := make(map[*node]struct{})
+	for n := last; n != nil; n = next[n] {
+		if _, ok := seen[n]; ok {
+			break
+		}
+		seen[n] = struct{}{}
+		path = append(path, n)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// dependencies returns the constructors and decorators which may produce the
+// values n depends on.
+func (n *node) dependencies() []*node {
+	if n.providedTo == nil {
+		return nil
+	}
+	c := n.providedTo
+
+	var deps []*node
+	addDecorators := func(k key) {
+		for _, d := range c.getDecorators(k) {
+			// A decorator receives the values of the decorators applied
+			// before it.
+			if d == n {
+				break
+			}
+			deps = append(deps, d)
+		}
+	}
+	walkParam(n.paramList, paramVisitorFunc(func(p param) bool {
+		switch p := p.(type) {
+		case paramSingle:
+			for _, pr := range c.getValueProviders(p.Name, p.Type) {
+				if dep, ok := pr.(*node); ok && dep != n {
+					deps = append(deps, dep)
+				}
+			}
+			addDecorators(key{name: p.Name, t: p.Type})
+		case paramGroupedSlice:
+			for _, pr := range c.getGroupProviders(p.Group, p.Type.Elem()) {
+				if dep, ok := pr.(*node); ok {
+					deps = append(deps, dep)
+				}
+			}
+		default:
+			return true
+		}
+		return false
+	}))
+	return deps
+}
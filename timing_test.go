@@ -0,0 +1,164 @@
+// Copyright (c) 2019 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package dig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock which only moves forward when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) { c.now = c.now.Add(d) }
+
+// timingClock is the clock of the containers which call the constructors
+// below, which take time according to it.
+var timingClock = &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+type timedA struct{}
+type timedB struct{}
+type timedC struct{}
+type timedD struct{}
+
+func newTimedA() *timedA {
+	timingClock.Sleep(30 * time.Millisecond)
+	return &timedA{}
+}
+
+func newTimedB(*timedA) *timedB {
+	timingClock.Sleep(5 * time.Millisecond)
+	return &timedB{}
+}
+
+func newTimedC() *timedC {
+	timingClock.Sleep(20 * time.Millisecond)
+	return &timedC{}
+}
+
+func newTimedD(*timedB, *timedC) *timedD {
+	timingClock.Sleep(time.Millisecond)
+	return &timedD{}
+}
+
+func decorateTimedB(b *timedB) *timedB {
+	timingClock.Sleep(10 * time.Millisecond)
+	return b
+}
+
+func newTimedName() string {
+	timingClock.Sleep(2 * time.Millisecond)
+	return "a"
+}
+
+func decorateTimedName(s string) string {
+	timingClock.Sleep(3 * time.Millisecond)
+	return s
+}
+
+func TestStartupReport(t *testing.T) {
+	names := func(ts []ConstructorTiming) []string {
+		var names []string
+		for _, t := range ts {
+			names = append(names, t.Func.Name)
+		}
+		return names
+	}
+
+	t.Run("nothing called", func(t *testing.T) {
+		c := New()
+		require.NoError(t, c.Provide(newTimedA), "provide failed")
+
+		r := c.StartupReport()
+		assert.Empty(t, r.Constructors)
+		assert.Empty(t, r.CriticalPath)
+	})
+
+	t.Run("cost and critical path", func(t *testing.T) {
+		c := New(setClock(timingClock.Now))
+		child := c.Child("child")
+		for _, ctor := range []interface{}{newTimedA, newTimedB, newTimedC} {
+			require.NoError(t, c.Provide(ctor), "provide failed")
+		}
+		require.NoError(t, child.Provide(newTimedD), "provide failed")
+		require.NoError(t, child.Decorate(decorateTimedB), "decorate failed")
+
+		require.NoError(t, child.Invoke(func(*timedD) {}), "invoke failed")
+
+		r := c.StartupReport()
+		assert.Equal(t, []string{"newTimedA", "newTimedC", "decorateTimedB", "newTimedB", "newTimedD"},
+			names(r.Constructors))
+		assert.Equal(t, []string{"newTimedA", "newTimedB", "decorateTimedB", "newTimedD"},
+			names(r.CriticalPath))
+
+		type timing struct {
+			Container       string
+			Start, Duration time.Duration
+		}
+		timings := make(map[string]timing)
+		for _, ct := range r.Constructors {
+			timings[ct.Func.Name] = timing{ct.Container, ct.Start, ct.Duration}
+		}
+		// newTimedD starts after its dependencies, and the time spent building
+		// them is excluded from its duration.
+		assert.Equal(t, map[string]timing{
+			"newTimedA":      {"root", 0, 30 * time.Millisecond},
+			"newTimedB":      {"root", 30 * time.Millisecond, 5 * time.Millisecond},
+			"decorateTimedB": {"root/child", 35 * time.Millisecond, 10 * time.Millisecond},
+			"newTimedC":      {"root", 45 * time.Millisecond, 20 * time.Millisecond},
+			"newTimedD":      {"root/child", 65 * time.Millisecond, time.Millisecond},
+		}, timings)
+
+		r = child.StartupReport()
+		assert.Equal(t, []string{"decorateTimedB", "newTimedD"}, names(r.Constructors))
+	})
+
+	t.Run("element decorators", func(t *testing.T) {
+		c := New(setClock(timingClock.Now))
+		start := timingClock.Now()
+		require.NoError(t, c.Provide(newTimedName, Group("names")), "provide failed")
+		require.NoError(t, c.Provide(newTimedName, Group("names")), "provide failed")
+		require.NoError(t, c.Decorate(decorateTimedName, Group("names")), "decorate failed")
+
+		require.NoError(t, c.Invoke(func(struct {
+			In
+
+			Names []string `group:"names"`
+		}) {
+		}), "invoke failed")
+
+		r := c.StartupReport()
+		assert.Equal(t, []string{"decorateTimedName", "newTimedName", "newTimedName"}, names(r.Constructors))
+		// The decorator is called for each value of the group when the group
+		// is consumed, after both constructors returned.
+		assert.Equal(t, 4*time.Millisecond, r.Constructors[0].Start)
+		assert.Equal(t, 6*time.Millisecond, r.Constructors[0].Duration)
+		assert.Equal(t, 10*time.Millisecond, timingClock.Now().Sub(start))
+		assert.NotContains(t, names(r.CriticalPath), "decorateTimedName")
+	})
+}
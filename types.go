@@ -55,8 +55,12 @@ type digSentinel interface {
 //   optional    If set to true, indicates that the dependency is optional and
 //               the constructor gracefully handles its absence.
 //   group       Name of the Value Group from which this field will be filled.
-//               The field must be a slice type. See Value Groups in the
-//               package documentation for more information.
+//               The field must be a slice type, or a map type with string
+//               keys to receive the values that were added with a key. The
+//               "soft" option may follow the name to receive only values
+//               that were already built, and the "min=N" and "max=N"
+//               options bound the number of values received. See Value
+//               Groups in the package documentation for more information.
 type In struct{ digSentinel }
 
 // Out is an embeddable type that signals to dig that the returned
@@ -76,8 +80,10 @@ type In struct{ digSentinel }
 //               struct with the same 'name' annotation can receive this
 //               value. See Named Values for more information.
 //   group       Name of the Value Group to which this field's value is being
-//               sent. See Value Groups in the package documentation for more
-//               information.
+//               sent, optionally followed by the "flatten" option to send
+//               each element of a slice individually or the "key=.." option
+//               to send the value under a key. See Value Groups in the
+//               package documentation for more information.
 type Out struct{ digSentinel }
 
 func isError(t reflect.Type) bool {